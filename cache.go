@@ -0,0 +1,207 @@
+package dlrouter
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	DefaultCacheShards = 16
+)
+
+//CacheStats are the counters of a RouterCache since it was created.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64 //lookups of the router whose result was cached
+	Bypasses  uint64 //lookups of the router whose result was not cached
+	Evictions uint64
+	Swaps     uint64
+}
+
+//HitRatio returns the ratio of the lookups answered by the cache.
+func (s CacheStats) HitRatio() float64 {
+	total := s.Hits + s.Misses + s.Bypasses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+type CacheOption func(*RouterCache)
+
+//WithCacheShards sets the number of the shards of the cache, DefaultCacheShards by default.
+//Lookups of different shards do not contend.
+func WithCacheShards(shards int) CacheOption {
+	return func(rc *RouterCache) {
+		if shards > 0 {
+			rc.shards = shards
+		}
+	}
+}
+
+//WithCacheVariables caches the results binding path variables too. By default they are not cached, as every
+//value of the variables would take an entry.
+func WithCacheVariables() CacheOption {
+	return func(rc *RouterCache) {
+		rc.cacheVariables = true
+	}
+}
+
+//WithCacheBypass sets a function telling which requests are looked up without the cache,
+//like the paths known to have high cardinality.
+func WithCacheBypass(bypass func(domain, path string) bool) CacheOption {
+	return func(rc *RouterCache) {
+		rc.bypass = bypass
+	}
+}
+
+//RouterCache is a bounded cache of the results of GetTarget in front of a router, keyed by the domain, as given
+//since the router is case-sensitive, and the path. The cache is sharded, every shard evicting by the CLOCK algorithm.
+//Swapping the router clears the cache at once.
+type RouterCache struct {
+	shards         int
+	shardSize      int
+	cacheVariables bool
+	bypass         func(domain, path string) bool
+
+	state atomic.Pointer[cacheState]
+
+	hits, misses, bypasses, evictions, swaps atomic.Uint64
+}
+
+//cacheState is a router and the cache of its results, replaced as a whole on a swap.
+type cacheState struct {
+	router *DomainLocationRouter
+	shards []cacheShard
+}
+
+type cacheEntry struct {
+	key        string
+	target     *Target
+	found      bool
+	referenced bool
+}
+
+type cacheShard struct {
+	mu      sync.Mutex
+	index   map[string]int //key -> entry
+	entries []cacheEntry
+	hand    int
+}
+
+//NewRouterCache caches up to size results of router.
+func NewRouterCache(router *DomainLocationRouter, size int, opts ...CacheOption) *RouterCache {
+	rc := &RouterCache{shards: DefaultCacheShards}
+	for _, opt := range opts {
+		opt(rc)
+	}
+	if size < rc.shards {
+		size = rc.shards
+	}
+	rc.shardSize = (size + rc.shards - 1) / rc.shards
+	rc.state.Store(rc.newState(router))
+	return rc
+}
+
+func (rc *RouterCache) newState(router *DomainLocationRouter) *cacheState {
+	state := &cacheState{router: router, shards: make([]cacheShard, rc.shards)}
+	for i := range state.shards {
+		state.shards[i].index = make(map[string]int, rc.shardSize)
+		state.shards[i].entries = make([]cacheEntry, 0, rc.shardSize)
+	}
+	return state
+}
+
+//Router returns the router cached.
+func (rc *RouterCache) Router() *DomainLocationRouter {
+	return rc.state.Load().router
+}
+
+//Swap replaces the router cached, dropping the cached results of the previous one.
+func (rc *RouterCache) Swap(router *DomainLocationRouter) {
+	rc.state.Store(rc.newState(router))
+	rc.swaps.Add(1)
+}
+
+func (rc *RouterCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:      rc.hits.Load(),
+		Misses:    rc.misses.Load(),
+		Bypasses:  rc.bypasses.Load(),
+		Evictions: rc.evictions.Load(),
+		Swaps:     rc.swaps.Load(),
+	}
+}
+
+//GetTarget is GetTarget of the router, cached.
+func (rc *RouterCache) GetTarget(domain string, path string) (*Target, bool) {
+	state := rc.state.Load()
+	if rc.bypass != nil && rc.bypass(domain, path) {
+		rc.bypasses.Add(1)
+		return state.router.GetTarget(domain, path)
+	}
+
+	key := domain + " " + path
+	shard := &state.shards[cacheHash(key)%uint32(len(state.shards))]
+	if target, found, present := shard.get(key); present {
+		rc.hits.Add(1)
+		return target, found
+	}
+
+	target, found := state.router.GetTarget(domain, path)
+	if found && len(target.Variables) > 0 && !rc.cacheVariables {
+		rc.bypasses.Add(1)
+		return target, found
+	}
+	rc.misses.Add(1)
+	if shard.put(key, target, found, rc.shardSize) {
+		rc.evictions.Add(1)
+	}
+	return target, found
+}
+
+//cacheHash is the 32-bit FNV-1a hash of key.
+func cacheHash(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h
+}
+
+func (s *cacheShard) get(key string) (*Target, bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, present := s.index[key]
+	if !present {
+		return nil, false, false
+	}
+	s.entries[i].referenced = true
+	return s.entries[i].target, s.entries[i].found, true
+}
+
+//put caches the result of key, evicting the first entry not referenced since the hand last passed it
+//if the shard is full. It returns whether an entry was evicted.
+func (s *cacheShard) put(key string, target *Target, found bool, size int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, present := s.index[key]; present { //cached by a concurrent lookup
+		return false
+	}
+	entry := cacheEntry{key: key, target: target, found: found}
+	if len(s.entries) < size {
+		s.index[key] = len(s.entries)
+		s.entries = append(s.entries, entry)
+		return false
+	}
+	for s.entries[s.hand].referenced {
+		s.entries[s.hand].referenced = false
+		s.hand = (s.hand + 1) % len(s.entries)
+	}
+	delete(s.index, s.entries[s.hand].key)
+	s.index[key] = s.hand
+	s.entries[s.hand] = entry
+	s.hand = (s.hand + 1) % len(s.entries)
+	return true
+}
@@ -0,0 +1,96 @@
+package dlrouter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func getCacheRouter(t testing.TB, target string) *DomainLocationRouter {
+	router, errs := NewRouter([]*LocationConf{{
+		Target: target,
+		MappingConf: []*MappingBlock{
+			{Domains: []string{"shop.com"}, Locations: []string{"/cart/", "/users/:id"}},
+		},
+	}})
+	if len(errs) > 0 {
+		t.Fatalf("NewRouter errors: %v", errs)
+	}
+	return router
+}
+
+func TestRouterCache(t *testing.T) {
+	rc := NewRouterCache(getCacheRouter(t, "v1"), 4, WithCacheShards(1))
+
+	for i := 0; i < 3; i++ {
+		if target, found := rc.GetTarget("shop.com", "/cart/1"); !found || target.Value != "v1" {
+			t.Errorf("target expected: v1; got: %v", target)
+		}
+	}
+	if _, found := rc.GetTarget("shop.com", "/missing"); found {
+		t.Errorf("no target expected for /missing")
+	}
+	rc.GetTarget("shop.com", "/missing")
+	if target, _ := rc.GetTarget("shop.com", "/users/42"); target.Variables["id"] != "42" {
+		t.Errorf("variable id expected: 42; got: %v", target.Variables)
+	}
+	if stats := rc.Stats(); stats != (CacheStats{Hits: 3, Misses: 2, Bypasses: 1}) {
+		t.Errorf("stats expected: 3 hits, 2 misses, 1 bypass; got: %+v", stats)
+	}
+
+	for i := 0; i < 10; i++ { //9 misses beside /cart/1, filling 2 entries and evicting 7
+		rc.GetTarget("shop.com", fmt.Sprintf("/cart/%d", i))
+	}
+	if stats := rc.Stats(); stats.Evictions != 7 || stats.Misses != 11 {
+		t.Errorf("evictions expected: 7; got: %+v", stats)
+	}
+
+	rc.Swap(getCacheRouter(t, "v2"))
+	if target, _ := rc.GetTarget("shop.com", "/cart/9"); target.Value != "v2" || rc.Stats().Misses != 12 {
+		t.Errorf("target of the swapped router expected: v2; got: %v, %+v", target, rc.Stats())
+	}
+}
+
+func TestRouterCacheSameAsRouter(t *testing.T) {
+	router, errs := NewRouter([]*LocationConf{
+		{Target: "upper", MappingConf: []*MappingBlock{{Domains: []string{"Shop.com"}, Locations: []string{"/"}}}},
+		{Target: "lower", MappingConf: []*MappingBlock{{Domains: []string{"shop.com"}, Locations: []string{"/cart/"}}}},
+	})
+	if len(errs) > 0 {
+		t.Fatalf("NewRouter errors: %v", errs)
+	}
+	rc := NewRouterCache(router, 16)
+	for round := 0; round < 2; round++ {
+		for _, domain := range []string{"Shop.com", "shop.com", "SHOP.COM"} {
+			for _, path := range []string{"/cart/1", "/other"} {
+				expected, expectedFound := router.GetTarget(domain, path)
+				target, found := rc.GetTarget(domain, path)
+				if found != expectedFound || found && target.Value != expected.Value {
+					t.Errorf("cached target of %s%s expected: %v; got: %v", domain, path, expected, target)
+				}
+			}
+		}
+	}
+}
+
+func TestRouterCacheOptions(t *testing.T) {
+	rc := NewRouterCache(getCacheRouter(t, "v1"), 100, WithCacheVariables(), WithCacheBypass(func(domain, path string) bool {
+		return strings.HasPrefix(path, "/cart/")
+	}))
+	rc.GetTarget("shop.com", "/users/42")
+	rc.GetTarget("shop.com", "/users/42")
+	rc.GetTarget("shop.com", "/cart/1")
+	if stats := rc.Stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Bypasses != 1 || stats.HitRatio() != 1.0/3 {
+		t.Errorf("stats expected: 1 hit, 1 miss, 1 bypass; got: %+v", stats)
+	}
+}
+
+func BenchmarkRouterCache(b *testing.B) {
+	rc := NewRouterCache(getCacheRouter(b, "v1"), 1024)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			rc.GetTarget("shop.com", "/cart/1")
+		}
+	})
+}
@@ -0,0 +1,90 @@
+//Command dlreplay replays access logs through the router of a configuration directory, reporting the hits of
+//every location and the requests no location matches. Given a second configuration directory with -new,
+//it also reports every request routed to another target by the new configuration.
+//
+//	dlreplay -conf routes/ [-new routes.next/] [-format auto|combined|json] [-host example.com] [access.log ...]
+//
+//The logs are read from the standard input if no file is given. The exit status is 1 if a request changed target.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/conndots/dlrouter"
+	"github.com/conndots/dlrouter/loader"
+	"github.com/conndots/dlrouter/replay"
+)
+
+func main() {
+	confDir := flag.String("conf", "", "directory of the configuration files")
+	newDir := flag.String("new", "", "directory of the configuration files to compare with")
+	formatName := flag.String("format", "auto", "format of the access logs: auto, combined or json")
+	host := flag.String("host", "", "host of the requests whose log line has none")
+	flag.Parse()
+
+	format, ok := replay.ParseFormat(*formatName)
+	if !ok || len(*confDir) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	router := loadRouter(*confDir)
+	var newRouter *dlrouter.DomainLocationRouter
+	if len(*newDir) > 0 {
+		newRouter = loadRouter(*newDir)
+	}
+
+	readers := make([]io.Reader, 0, flag.NArg())
+	for _, filename := range flag.Args() {
+		f, err := os.Open(filename)
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		readers = append(readers, f, strings.NewReader("\n")) //lines do not span files
+	}
+	if len(readers) == 0 {
+		readers = append(readers, os.Stdin)
+	}
+	r := replay.NewReader(io.MultiReader(readers...), format, *host)
+
+	var report *replay.Report
+	var err error
+	if newRouter == nil {
+		report, err = replay.Replay(r, router)
+	} else {
+		report, err = replay.Compare(r, router, newRouter)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	if err := report.Write(os.Stdout); err != nil {
+		fatal(err)
+	}
+	if len(report.Changes) > 0 {
+		os.Exit(1)
+	}
+}
+
+func loadRouter(dir string) *dlrouter.DomainLocationRouter {
+	confs, _, err := loader.New(dir).ReadConfs()
+	if err != nil {
+		fatal(err)
+	}
+	router, errs := dlrouter.NewRouter(confs)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(2)
+	}
+	return router
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(2)
+}
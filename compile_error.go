@@ -0,0 +1,71 @@
+package dlrouter
+
+import (
+	"fmt"
+)
+
+type CompileErrorKind uint8
+
+const (
+	CompileErrorConf        CompileErrorKind = iota //the LocationConf can not be split into domain configurations
+	CompileErrorDomain                              //the configuration is appended to the router of another domain
+	CompileErrorRegex                               //the regex of a location does not compile
+	CompileErrorPrefix                              //the prefix location can not be added to the location tree
+	CompileErrorDomainIndex                         //the domain can not be added to the domain search trees
+	CompileErrorRoute                               //the named location of a block can not be a route
+	CompileErrorRewrite                             //the rewrite rule of a location does not compile
+	CompileErrorConflict                            //another target of the same priority has the location
+)
+
+var compileErrorKindNames = [...]string{
+	CompileErrorConf:        "conf",
+	CompileErrorDomain:      "domain",
+	CompileErrorRegex:       "regex",
+	CompileErrorPrefix:      "prefix",
+	CompileErrorDomainIndex: "domain index",
+	CompileErrorRoute:       "route",
+	CompileErrorRewrite:     "rewrite",
+	CompileErrorConflict:    "conflict",
+}
+
+func (k CompileErrorKind) String() string {
+	if int(k) < len(compileErrorKindNames) {
+		return compileErrorKindNames[k]
+	}
+	return "unknown"
+}
+
+//SourcePos is the position of a configuration entry in its source file. A zero Line means unknown.
+type SourcePos struct {
+	File string
+	Line int
+}
+
+func (p SourcePos) String() string {
+	if p.Line == 0 {
+		return p.File
+	}
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+//CompileError is the error of NewRouter and DomainRouter.AppendConf for a domain or a location
+//which can not be compiled. Use errors.As to inspect it.
+type CompileError struct {
+	Kind     CompileErrorKind
+	Domain   string
+	Location string
+	Pos      SourcePos //position of the location, or of its MappingBlock, if parsed with ParseMappingBlocks
+	Err      error
+}
+
+func (e *CompileError) Error() string {
+	msg := fmt.Sprintf("[dlrouter compile] Compile Error: %v. Kind: %s. Domain: %s. Location: %s", e.Err, e.Kind, e.Domain, e.Location)
+	if e.Pos.Line > 0 || len(e.Pos.File) > 0 {
+		msg += ". Source: " + e.Pos.String()
+	}
+	return msg
+}
+
+func (e *CompileError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,69 @@
+package dlrouter
+
+import (
+	"errors"
+	"testing"
+)
+
+var invalidConf = `- domains:
+    - hotsoon.bytedance.com
+  locations:
+    - = /api/account/info
+    - ~ /api/video/detail/[0-9+
+    - /page/video/
+- domains:
+    - api.hotsoon.com
+  locations:
+    - ~ /api/(hotsoon
+`
+
+func TestCompileErrorPositions(t *testing.T) {
+	blocks, err := ParseMappingBlocks("hotsoon.yaml", []byte(invalidConf))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if blocks[1].Pos.Line != 7 || blocks[1].Pos.File != "hotsoon.yaml" || len(blocks[0].LocationPos) != 3 {
+		t.Errorf("block positions error: %v %v", blocks[1].Pos, blocks[0].LocationPos)
+	}
+
+	router, errs := NewRouter([]*LocationConf{{Target: 1, MappingConf: blocks}})
+	if router == nil || len(errs) != 2 {
+		t.Fatalf("compile errors expected: 2; got: %v", errs)
+	}
+	var compileErr *CompileError
+	if !errors.As(errs[0], &compileErr) {
+		t.Fatalf("errors.As CompileError failed: %v", errs[0])
+	}
+	if compileErr.Kind != CompileErrorRegex || compileErr.Domain != "hotsoon.bytedance.com" ||
+		compileErr.Location != "~ /api/video/detail/[0-9+" || compileErr.Pos.String() != "hotsoon.yaml:5" {
+		t.Errorf("compile error fields error: %+v", compileErr)
+	}
+	if errors.As(errs[1], &compileErr); compileErr.Pos.Line != 10 {
+		t.Errorf("compile error position expected: 10; got: %v", compileErr.Pos)
+	}
+
+	if _, exist := router.GetTarget("hotsoon.bytedance.com", "/page/video/1"); !exist {
+		t.Errorf("valid locations expected to be routed")
+	}
+}
+
+func TestStrictCompile(t *testing.T) {
+	blocks, _ := ParseMappingBlocks("hotsoon.yaml", []byte(invalidConf))
+	router, errs := NewRouter([]*LocationConf{{Target: 1, MappingConf: blocks}}, WithStrictCompile())
+	if router != nil || len(errs) != 1 {
+		t.Errorf("strict compile expected: nil router and 1 error; got: %v %v", router, errs)
+	}
+
+	router, errs = NewRouter(testData, WithStrictCompile())
+	if router == nil || len(errs) > 0 {
+		t.Errorf("strict compile of valid confs error: %v", errs)
+	}
+}
+
+func TestAppendConfOtherDomain(t *testing.T) {
+	errs := NewDomainRouter("a.com").AppendConf(&DomainConf{Domain: "b.com", Locations: []string{"/"}, Target: 1})
+	var compileErr *CompileError
+	if len(errs) != 1 || !errors.Is(errs[0], NotSameDomainErr) || !errors.As(errs[0], &compileErr) || compileErr.Kind != CompileErrorDomain {
+		t.Errorf("append conf of another domain error: %v", errs)
+	}
+}
@@ -0,0 +1,376 @@
+package dlrouter
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//confExporter collects the locations of every target per domain, and the orders of the locations
+//implied by the lists whose order follows the order of the configurations passed to NewRouter.
+type confExporter struct {
+	targets   *targetSet
+	locations []map[string][]string       //target id -> domain -> locations
+	rewrites  []map[string][]*RewriteConf //target id -> domain -> rewrite rules
+	priority  []map[string]int            //target id -> domain and location -> priority, if not 0
+	orders    [][]exportNode              //the lists of locations whose order matters, in their order
+}
+
+//exportNode is a location of a target for a domain.
+type exportNode struct {
+	id               int
+	domain, location string
+}
+
+//exportPiece is the part of the locations of a target exported as one LocationConf.
+type exportPiece struct {
+	id        int
+	locations map[string][]string //domain -> locations, in the order of the locations of the target
+}
+
+//the granularities the orders are sorted at, each splitting the targets further than the previous one
+const (
+	exportByTarget = iota
+	exportByDomain
+	exportByLocation
+)
+
+func (ce *confExporter) id(target interface{}) int {
+	id := ce.targets.id(target)
+	for len(ce.locations) <= id {
+		ce.locations = append(ce.locations, make(map[string][]string, 2))
+		ce.rewrites = append(ce.rewrites, make(map[string][]*RewriteConf))
+		ce.priority = append(ce.priority, make(map[string]int))
+	}
+	return id
+}
+
+func (ce *confExporter) add(target interface{}, domain, location string, priority int) {
+	id := ce.id(target)
+	if !slices.Contains(ce.locations[id][domain], location) {
+		ce.locations[id][domain] = append(ce.locations[id][domain], location)
+	}
+	if priority != 0 {
+		ce.priority[id][domain+" "+location] = priority
+	}
+}
+
+//priorityGroups splits the locations of a target for a domain by priority, in the order of their first occurrences.
+func (ce *confExporter) priorityGroups(id int, domain string, locations []string) ([]int, map[int][]string) {
+	priorities := make([]int, 0, 1)
+	groups := make(map[int][]string, 1)
+	for _, location := range locations {
+		priority := ce.priority[id][domain+" "+location]
+		if _, present := groups[priority]; !present {
+			priorities = append(priorities, priority)
+		}
+		groups[priority] = append(groups[priority], location)
+	}
+	return priorities, groups
+}
+
+//order records that the locations of domain were configured in the order of the targets.
+func (ce *confExporter) order(domain string, targets []interface{}, locations []string) {
+	nodes := make([]exportNode, 0, len(targets))
+	for i, t := range targets {
+		nodes = append(nodes, exportNode{id: ce.id(t), domain: domain, location: locations[i]})
+	}
+	ce.orders = append(ce.orders, nodes)
+}
+
+//key returns the key of the node at a granularity.
+func (node exportNode) key(level int) exportNode {
+	switch level {
+	case exportByTarget:
+		return exportNode{id: node.id}
+	case exportByDomain:
+		return exportNode{id: node.id, domain: node.domain}
+	}
+	return node
+}
+
+//sortedPieces sorts the targets topologically by the recorded orders, breaking ties by the order the targets
+//were first seen in. If the orders of the targets conflict, which is only possible with a target used by several
+//configurations, the targets are split by domain, or by location if the orders still conflict, and the adjacent
+//parts of a target are merged back.
+func (ce *confExporter) sortedPieces() []*exportPiece {
+	for level := exportByTarget; ; level++ {
+		nodes, sorted := ce.sortedNodes(level)
+		if !sorted && level < exportByLocation {
+			continue
+		}
+		pieces := make([]*exportPiece, 0, len(nodes))
+		for _, node := range nodes {
+			if len(pieces) == 0 || pieces[len(pieces)-1].id != node.id {
+				pieces = append(pieces, &exportPiece{id: node.id, locations: make(map[string][]string, 2)})
+			}
+			piece := pieces[len(pieces)-1]
+			for domain, locations := range ce.locations[node.id] {
+				if level != exportByTarget && domain != node.domain {
+					continue
+				}
+				for _, location := range locations {
+					if level != exportByLocation || location == node.location {
+						piece.locations[domain] = append(piece.locations[domain], location)
+					}
+				}
+			}
+		}
+		return pieces
+	}
+}
+
+//sortedNodes sorts the nodes of a granularity topologically, reporting false if their orders have a cycle.
+//The orders of locations have none, their cycles are broken anyway by the order the nodes were first seen in.
+func (ce *confExporter) sortedNodes(level int) ([]exportNode, bool) {
+	nodes := make([]exportNode, 0, len(ce.targets.values))
+	index := make(map[exportNode]int, len(ce.targets.values))
+	for id := range ce.targets.values {
+		if level == exportByTarget || len(ce.locations[id]) == 0 {
+			index[exportNode{id: id}] = len(nodes)
+			nodes = append(nodes, exportNode{id: id})
+			continue
+		}
+		domains := make([]string, 0, len(ce.locations[id]))
+		for domain := range ce.locations[id] {
+			domains = append(domains, domain)
+		}
+		sort.Strings(domains)
+		for _, domain := range domains {
+			for _, location := range ce.locations[id][domain] {
+				node := exportNode{id: id, domain: domain, location: location}.key(level)
+				if _, present := index[node]; !present {
+					index[node] = len(nodes)
+					nodes = append(nodes, node)
+				}
+			}
+		}
+	}
+
+	before := make([]map[int]bool, len(nodes)) //node -> nodes configured after it
+	inDegree := make([]int, len(nodes))
+	for _, list := range ce.orders {
+		prev := -1
+		seen := make(map[int]bool, len(list))
+		for _, node := range list {
+			i := index[node.key(level)]
+			if seen[i] {
+				continue
+			}
+			seen[i] = true
+			if prev >= 0 {
+				if before[prev] == nil {
+					before[prev] = make(map[int]bool, 2)
+				}
+				if !before[prev][i] {
+					before[prev][i] = true
+					inDegree[i]++
+				}
+			}
+			prev = i
+		}
+	}
+
+	sorted := make([]exportNode, 0, len(nodes))
+	done := make([]bool, len(nodes))
+	for len(sorted) < len(nodes) {
+		next := -1
+		for i := range nodes {
+			if !done[i] && inDegree[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 && level < exportByLocation {
+			return nil, false
+		}
+		for i := 0; next < 0; i++ {
+			if !done[i] {
+				next = i
+			}
+		}
+		done[next] = true
+		sorted = append(sorted, nodes[next])
+		for i := range before[next] {
+			inDegree[i]--
+		}
+	}
+	return sorted, true
+}
+
+//ExportConfs reconstructs the location configurations of the router: one LocationConf per target, in the
+//order they were passed to NewRouter as far as the routing tells, with the domains sharing identical locations
+//regrouped into one MappingBlock. A target whose locations are ordered differently against other targets
+//in different domains is split into several LocationConfs. A router built from the export routes every request
+//the same way and has the same routes.
+//The locations of a target with a priority are exported in blocks of that priority.
+//Domains configured without any location are not exported. The default servers are exported as
+//blocks without domains.
+func (m *DomainLocationRouter) ExportConfs() []*LocationConf {
+	ce := &confExporter{
+		targets:   newTargetSet(),
+		locations: make([]map[string][]string, 0, 4),
+		rewrites:  make([]map[string][]*RewriteConf, 0, 4),
+		orders:    make([][]exportNode, 0, 8),
+	}
+
+	defaultPorts := make(map[string]int, len(m.defaultServers)) //domain of the default server routers -> port
+	for port, dm := range m.defaultServers {
+		defaultPorts[dm.Domain] = port
+	}
+
+	for _, dm := range append(m.sortedDomainRouters(), m.DefaultServers()...) {
+		locations := make([]string, 0, len(dm.LocationExactSearch))
+		for location := range dm.LocationExactSearch {
+			locations = append(locations, location)
+		}
+		sort.Strings(locations)
+		for _, location := range locations {
+			tlist := dm.LocationExactSearch[location]
+			priorities := dm.locationPriorities(exactPattern(location), len(tlist))
+			ce.order(dm.Domain, tlist, repeated(exactPattern(location), len(tlist)))
+			for i, t := range tlist {
+				ce.add(t, dm.Domain, exactPattern(location), priorities[i])
+			}
+		}
+
+		dm.LocationPrefixSearch.WalkPriorities(func(pattern string, values []interface{}, priorities []int) bool {
+			ce.order(dm.Domain, values, repeated(pattern, len(values)))
+			for i, t := range values {
+				ce.add(t, dm.Domain, pattern, priorities[i])
+			}
+			return true
+		})
+
+		regexTargets := make([]interface{}, 0, len(dm.regexOrder))
+		regexLocations := make([]string, 0, len(dm.regexOrder))
+		for _, regexTar := range dm.regexOrder {
+			pattern := regexPattern(regexTar.RegexExp.String())
+			priorities := dm.locationPriorities(pattern, len(regexTar.Targets))
+			for i, t := range regexTar.Targets {
+				ce.add(t, dm.Domain, pattern, priorities[i])
+				regexTargets = append(regexTargets, t)
+				regexLocations = append(regexLocations, pattern)
+			}
+		}
+		ce.order(dm.Domain, regexTargets, regexLocations)
+
+		for _, rule := range dm.rewriteRules() {
+			id := ce.id(rule.target)
+			ce.rewrites[id][dm.Domain] = append(ce.rewrites[id][dm.Domain], rule.conf)
+		}
+	}
+
+	routes := make(map[int][]*Route, len(m.routes))
+	for _, route := range m.Routes() {
+		id := ce.id(route.Target)
+		routes[id] = append(routes[id], route)
+	}
+
+	confs := make([]*LocationConf, 0, len(ce.targets.values))
+	for _, piece := range ce.sortedPieces() {
+		id := piece.id
+		domains := make([]string, 0, len(piece.locations))
+		for domain := range piece.locations {
+			domains = append(domains, domain)
+		}
+		sort.Strings(domains)
+
+		blocks := make([]*MappingBlock, 0, 2)
+		blockOfLocations := make(map[string]*MappingBlock, 2)
+		for _, domain := range domains {
+			priorities, groups := ce.priorityGroups(id, domain, piece.locations[domain])
+			for _, priority := range priorities {
+				locations := groups[priority]
+				rewrites := make([]*RewriteConf, 0, len(ce.rewrites[id][domain]))
+				for _, rw := range ce.rewrites[id][domain] {
+					if slices.Contains(locations, rw.Location) {
+						rewrites = append(rewrites, rw)
+					}
+				}
+				if len(rewrites) == 0 {
+					rewrites = nil
+				}
+				key := fmt.Sprintf("%d\n%s", priority, strings.Join(locations, "\n"))
+				for _, rw := range rewrites {
+					key += fmt.Sprintf("\n%q %q %q %q", rw.Location, rw.Regex, rw.Replacement, rw.Flag)
+				}
+				port, isDefault := defaultPorts[domain]
+				if isDefault {
+					key = fmt.Sprintf("default server %t\n%s", port == 0, key)
+				}
+				block, present := blockOfLocations[key]
+				if !present {
+					block = &MappingBlock{
+						Domains:       make([]string, 0, 2),
+						Locations:     locations,
+						Rewrites:      rewrites,
+						DefaultServer: isDefault,
+						Priority:      priority,
+					}
+					blockOfLocations[key] = block
+					blocks = append(blocks, block)
+				}
+				if !isDefault {
+					block.Domains = append(block.Domains, domain)
+				} else if port != 0 {
+					block.DefaultPorts = append(block.DefaultPorts, port)
+				}
+			}
+		}
+		for _, route := range routes[id] {
+			nameRoute(blocks, route)
+		}
+
+		confs = append(confs, &LocationConf{
+			Target:      ce.targets.values[id],
+			MappingConf: blocks,
+		})
+	}
+	return confs
+}
+
+func repeated(location string, n int) []string {
+	locations := make([]string, n)
+	for i := range locations {
+		locations[i] = location
+	}
+	return locations
+}
+
+//nameRoute names the location of the route in the block of its domain, moving the domain to the front
+//of the block to keep it canonical.
+func nameRoute(blocks []*MappingBlock, route *Route) {
+	for _, block := range blocks {
+		pos := -1
+		for i, domain := range block.Domains {
+			if domain == route.Domain {
+				pos = i
+			}
+		}
+		if pos < 0 || !slices.Contains(block.Locations, route.Location) {
+			continue
+		}
+		copy(block.Domains[1:pos+1], block.Domains[:pos])
+		block.Domains[0] = route.Domain
+		if block.Names == nil {
+			block.Names = make(map[string]string, 1)
+		}
+		block.Names[route.Name] = route.Location
+		return
+	}
+}
+
+//ExportYAML encodes the configurations of ExportConfs as YAML.
+func (m *DomainLocationRouter) ExportYAML() ([]byte, error) {
+	return yaml.Marshal(m.ExportConfs())
+}
+
+//ExportJSON encodes the configurations of ExportConfs as JSON.
+func (m *DomainLocationRouter) ExportJSON() ([]byte, error) {
+	return json.Marshal(m.ExportConfs())
+}
@@ -0,0 +1,122 @@
+package dlrouter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestExportConfsRoundTrip(t *testing.T) {
+	sm := getMappingManager()
+	confs := sm.ExportConfs()
+	if len(confs) != 3 || confs[0].Target != 1 || confs[1].Target != 2 || confs[2].Target != 3 {
+		t.Fatalf("exported targets expected: [1 2 3]; got: %v", confs)
+	}
+
+	rebuilt, errs := NewRouter(confs)
+	if len(errs) > 0 {
+		t.Fatalf("rebuild errors: %v", errs)
+	}
+	assertSameRouting(t, sm, rebuilt)
+
+	expected, _ := json.Marshal(sm)
+	got, _ := json.Marshal(rebuilt)
+	if string(expected) != string(got) {
+		t.Errorf("rebuilt router differs.\nexpected: %s\ngot: %s", expected, got)
+	}
+
+	//the regexes of A and B are ordered differently in x.com and y.com
+	sm, errs = NewRouter([]*LocationConf{
+		{Target: "A", MappingConf: []*MappingBlock{{Domains: []string{"x.com"}, Locations: []string{"~ ^/api/"}}}},
+		{Target: "B", MappingConf: []*MappingBlock{
+			{Domains: []string{"x.com"}, Locations: []string{"~ ^/api/v1/"}},
+			{Domains: []string{"y.com"}, Locations: []string{"~ ^/api/"}},
+		}},
+		{Target: "A", MappingConf: []*MappingBlock{{Domains: []string{"y.com"}, Locations: []string{"~ ^/api/v1/"}}}},
+	})
+	if len(errs) > 0 {
+		t.Fatalf("NewRouter errors: %v", errs)
+	}
+	confs = sm.ExportConfs()
+	if len(confs) != 3 || confs[0].Target != "A" || confs[1].Target != "B" || confs[2].Target != "A" {
+		t.Fatalf("exported targets expected: [A B A]; got: %v", confs)
+	}
+	if rebuilt, errs = NewRouter(confs); len(errs) > 0 {
+		t.Fatalf("rebuild errors: %v", errs)
+	}
+	for _, req := range []Request{{"x.com", "/api/v1/x"}, {"y.com", "/api/v1/x"}, {"y.com", "/api/x"}} {
+		et, _ := sm.GetTarget(req.Domain, req.Path)
+		if gt, found := rebuilt.GetTarget(req.Domain, req.Path); !found || gt.Value != et.Value {
+			t.Errorf("target of %s%s expected: %v; got: %v", req.Domain, req.Path, et, gt)
+		}
+	}
+	if diff := Diff(sm, rebuilt); !diff.Empty() {
+		t.Errorf("rebuilt router differs:\n%s", diff)
+	}
+}
+
+func TestExportConfsRegroup(t *testing.T) {
+	sm, _ := NewRouter([]*LocationConf{{
+		Target: "t",
+		MappingConf: []*MappingBlock{
+			{Domains: []string{"a.com"}, Locations: []string{"/x", "~ ^/y/[0-9]+"}},
+			{Domains: []string{"b.com"}, Locations: []string{"~ ^/y/[0-9]+", "/x"}},
+			{Domains: []string{"c.com"}, Locations: []string{"= /x"}},
+		},
+	}})
+
+	data, err := sm.ExportYAML()
+	if err != nil {
+		t.Fatalf("export yaml error: %v", err)
+	}
+	var confs []*LocationConf
+	if err := yaml.Unmarshal(data, &confs); err != nil {
+		t.Fatalf("unmarshal yaml error: %v\n%s", err, data)
+	}
+	if len(confs) != 1 || confs[0].Target != "t" || len(confs[0].MappingConf) != 2 {
+		t.Fatalf("exported yaml error:\n%s", data)
+	}
+	block := confs[0].MappingConf[0]
+	if len(block.Domains) != 2 || block.Domains[1] != "b.com" || len(block.Locations) != 2 || block.Locations[1] != "~ ^/y/[0-9]+" {
+		t.Errorf("regrouped block error: %v", block)
+	}
+	if block = confs[0].MappingConf[1]; block.Domains[0] != "c.com" || block.Locations[0] != "= /x" {
+		t.Errorf("c.com block error: %v", block)
+	}
+}
+
+func TestLocationConfKeys(t *testing.T) {
+	for _, data := range []string{
+		"target: t\nmapping_conf:\n  - domains: [a.com]\n    locations: [/x]\n",
+		"target: t\nmappingconf:\n  - domains: [a.com]\n    locations: [/x]\n",
+		`{"target": "t", "mapping_conf": [{"domains": ["a.com"], "locations": ["/x"]}]}`,
+		`{"Target": "t", "MappingConf": [{"domains": ["a.com"], "locations": ["/x"]}]}`,
+	} {
+		conf, err := ParseLocationConf("t.yaml", []byte(data))
+		if err != nil || conf.Target != "t" || len(conf.MappingConf) != 1 || conf.MappingConf[0].Pos.File != "t.yaml" {
+			t.Errorf("conf of %s expected: t [a.com /x]; got: %v %v", data, conf, err)
+		}
+		if data[0] != '{' {
+			continue
+		}
+		var decoded LocationConf
+		if err := json.Unmarshal([]byte(data), &decoded); err != nil || decoded.Target != "t" || len(decoded.MappingConf) != 1 {
+			t.Errorf("json conf of %s expected: t [a.com /x]; got: %v %v", data, decoded, err)
+		}
+	}
+
+	for _, data := range []string{
+		"target: t\nmapping: [{domains: [a.com], locations: [/x]}]\n",
+		`{"target": "t", "mapping": [{"domains": ["a.com"], "locations": ["/x"]}]}`,
+		"target: t\nmapping_conf: [{domains: [a.com]}]\nmappingconf: [{domains: [b.com]}]\n",
+	} {
+		if _, err := ParseLocationConf("t.yaml", []byte(data)); err == nil {
+			t.Errorf("error expected for %s", data)
+		}
+	}
+	var decoded LocationConf
+	if err := json.Unmarshal([]byte(`{"target": "t", "mapping": []}`), &decoded); err == nil {
+		t.Errorf("json error expected for the unknown key mapping")
+	}
+}
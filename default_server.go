@@ -0,0 +1,178 @@
+package dlrouter
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//DefaultServerDomain is the domain of the default server router of every port.
+//The default server router of a port has the domain "_:<port>".
+const DefaultServerDomain = "_"
+
+//DomainStage is the stage of the domain search a DomainRouter is found by.
+type DomainStage uint8
+
+const (
+	StageExact   DomainStage = iota
+	StagePostfix             //the domain is a subdomain of the domain of the router, label by label
+	StagePrefix              //the domain starts with the domain of the router
+	StageDefault             //no router of the other stages has a location matching the path
+)
+
+var domainStageNames = [...]string{
+	StageExact:   "exact",
+	StagePostfix: "postfix",
+	StagePrefix:  "prefix",
+	StageDefault: "default",
+}
+
+func (s DomainStage) String() string {
+	if int(s) < len(domainStageNames) {
+		return domainStageNames[s]
+	}
+	return "unknown"
+}
+
+func defaultServerDomain(port int) string {
+	if port == 0 {
+		return DefaultServerDomain
+	}
+	return DefaultServerDomain + ":" + strconv.Itoa(port)
+}
+
+//addDefaultServer adds the locations of a block flagged DefaultServer to the default server routers of its ports.
+func addDefaultServer(defaults map[int]*DomainRouter, lconf *LocationConf, block *MappingBlock, conflict ConflictPolicy) []error {
+	ports := block.DefaultPorts
+	if len(ports) == 0 {
+		ports = []int{0}
+	}
+	errs := make([]error, 0, 1)
+	for _, port := range ports {
+		dm, present := defaults[port]
+		if !present {
+			dm = NewDomainRouter(defaultServerDomain(port))
+			dm.conflict = conflict
+			defaults[port] = dm
+		}
+		errs = append(errs, dm.AppendConf(&DomainConf{
+			Domain:      dm.Domain,
+			Locations:   block.Locations,
+			Target:      lconf.Target,
+			Rewrites:    block.Rewrites,
+			Priority:    block.priority(lconf.Priority),
+			Pos:         block.Pos,
+			LocationPos: block.LocationPos,
+		})...)
+	}
+	return errs
+}
+
+//splitHostPort splits a host:port domain into its host and port. A domain without a valid port is returned
+//whole with port 0, as is a bare IPv6 address.
+func splitHostPort(domain string) (string, int) {
+	pos := strings.LastIndexByte(domain, ':')
+	if pos < 0 || strings.IndexByte(domain[pos:], ']') >= 0 {
+		return domain, 0
+	}
+	if strings.IndexByte(domain[:pos], ':') >= 0 && !strings.HasPrefix(domain, "[") {
+		return domain, 0
+	}
+	port, err := strconv.Atoi(domain[pos+1:])
+	if err != nil || port <= 0 {
+		return domain, 0
+	}
+	return domain[:pos], port
+}
+
+//defaultServer returns the default server router of port, if any, or of every port.
+func (m *DomainLocationRouter) defaultServer(port int) *DomainRouter {
+	if len(m.defaultServers) == 0 {
+		return nil
+	}
+	if port > 0 {
+		if dm, present := m.defaultServers[port]; present {
+			return dm
+		}
+	}
+	return m.defaultServers[0]
+}
+
+//DefaultServer returns the default server router of port, 0 for the one of every port.
+func (m *DomainLocationRouter) DefaultServer(port int) (*DomainRouter, bool) {
+	dm, present := m.defaultServers[port]
+	return dm, present
+}
+
+//DefaultServers returns the default server routers ordered by port, the one of every port first.
+func (m *DomainLocationRouter) DefaultServers() []*DomainRouter {
+	ports := make([]int, 0, len(m.defaultServers))
+	for port := range m.defaultServers {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+	routers := make([]*DomainRouter, 0, len(ports))
+	for _, port := range ports {
+		routers = append(routers, m.defaultServers[port])
+	}
+	return routers
+}
+
+func (m *DomainLocationRouter) defaultPort(dm *DomainRouter) int {
+	for port, d := range m.defaultServers {
+		if d == dm {
+			return port
+		}
+	}
+	return 0
+}
+
+//ExplainStep is a DomainRouter tried by a lookup.
+type ExplainStep struct {
+	Stage   DomainStage
+	Router  *DomainRouter
+	Matched bool //whether a location of the router matched the path
+}
+
+//Explanation tells how a request is routed: the domain routers tried in order, and the one whose location matched.
+type Explanation struct {
+	Domain string
+	Path   string
+	Steps  []*ExplainStep
+	Router *DomainRouter //nil on a miss
+	Stage  DomainStage   //the stage of Router
+	Target *Target       //nil on a miss
+}
+
+//Explain looks up domain and path as GetTarget does, recording every DomainRouter tried.
+//With the BestLocation policy, every router of the domain is tried.
+func (m *DomainLocationRouter) Explain(domain, path string) *Explanation {
+	e := &Explanation{
+		Domain: domain,
+		Path:   path,
+		Steps:  make([]*ExplainStep, 0, 2),
+	}
+	e.Router, e.Stage, e.Target, _ = m.lookupTried(domain, path, func(dm *DomainRouter, stage DomainStage, hit bool) {
+		e.Steps = append(e.Steps, &ExplainStep{Stage: stage, Router: dm, Matched: hit})
+	})
+	return e
+}
+
+func (e *Explanation) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s%s:", e.Domain, e.Path)
+	for _, step := range e.Steps {
+		result := "miss"
+		if step.Matched {
+			result = "hit"
+		}
+		fmt.Fprintf(&sb, " %s %s %s;", step.Stage, step.Router.Domain, result)
+	}
+	if e.Target == nil {
+		sb.WriteString(" not found")
+	} else {
+		fmt.Fprintf(&sb, " %s -> %v", e.Target.Pattern, e.Target.Value)
+	}
+	return sb.String()
+}
@@ -0,0 +1,110 @@
+package dlrouter
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func getDefaultServerRouter(t *testing.T) *DomainLocationRouter {
+	router, errs := NewRouter([]*LocationConf{
+		{
+			Target: "shop",
+			MappingConf: []*MappingBlock{
+				{Domains: []string{"shop.com"}, Locations: []string{"/cart/"}},
+			},
+		},
+		{
+			Target: "wildcard",
+			MappingConf: []*MappingBlock{
+				{Domains: []string{".shop.com"}, Locations: []string{"/"}},
+			},
+		},
+		{
+			Target: "fallback",
+			MappingConf: []*MappingBlock{
+				{Locations: []string{"/"}, DefaultServer: true},
+			},
+		},
+		{
+			Target: "admin",
+			MappingConf: []*MappingBlock{
+				{Locations: []string{"/"}, DefaultServer: true, DefaultPorts: []int{8080, 9090}},
+			},
+		},
+	})
+	if len(errs) > 0 {
+		t.Fatalf("NewRouter errors: %v", errs)
+	}
+	return router
+}
+
+func TestDefaultServer(t *testing.T) {
+	router := getDefaultServerRouter(t)
+
+	requests := []struct {
+		domain, path string
+		target       interface{}
+		stage        DomainStage
+	}{
+		{"shop.com", "/cart/1", "shop", StageExact},
+		{"shop.com", "/other", "fallback", StageDefault},
+		{"unknown.com", "/", "fallback", StageDefault},
+		{"unknown.com:8080", "/", "admin", StageDefault},
+		{"unknown.com:8081", "/", "fallback", StageDefault},
+		{"[::1]:9090", "/", "admin", StageDefault},
+		{"shop.com:8080", "/cart/1", "shop", StageExact},
+		{"shop.com:8080", "/other", "admin", StageDefault},
+		{"www.shop.com:8080", "/x", "wildcard", StagePostfix},
+	}
+	for _, req := range requests {
+		target, found := router.GetTarget(req.domain, req.path)
+		if !found || target.Value != req.target {
+			t.Errorf("target of %s%s expected: %v; got: %v", req.domain, req.path, req.target, target)
+		}
+		e := router.Explain(req.domain, req.path)
+		if e.Target == nil || e.Target.Value != req.target || e.Stage != req.stage {
+			t.Errorf("explanation of %s%s expected: %v %v; got: %s", req.domain, req.path, req.stage, req.target, e)
+		}
+	}
+
+	e := router.Explain("shop.com", "/other")
+	if expected := "shop.com/other: exact shop.com miss; default _ hit; / -> fallback"; e.String() != expected {
+		t.Errorf("explanation expected: %s; got: %s", expected, e)
+	}
+	if routers, _ := router.GetRouterInfosOfDomain("unknown.com:9090"); len(routers) != 1 || routers[0].Domain != "_:9090" {
+		t.Errorf("routers of unknown.com:9090 expected: [_:9090]; got: %v", routers)
+	}
+	routers, _ := router.GetRouterInfosOfDomain("www.shop.com:9090")
+	if domains := fmt.Sprint(domainsOf(routers)); domains != "[.shop.com shop.com]" {
+		t.Errorf("routers of www.shop.com:9090 expected: [.shop.com shop.com]; got: %s", domains)
+	}
+	if targets, _ := router.GetAllTargets("www.shop.com:8080", "/x"); len(targets) != 1 || targets[0].Value != "wildcard" {
+		t.Errorf("targets of www.shop.com:8080/x expected: [wildcard]; got: %v", targets)
+	}
+}
+
+func TestDefaultServerRoundTrip(t *testing.T) {
+	router := getDefaultServerRouter(t)
+	expected, _ := json.Marshal(router)
+
+	exported, errs := NewRouter(router.ExportConfs())
+	if len(errs) > 0 {
+		t.Fatalf("rebuild errors: %v", errs)
+	}
+	if got, _ := json.Marshal(exported); string(got) != string(expected) {
+		t.Errorf("rebuilt router differs.\nexpected: %s\ngot: %s", expected, got)
+	}
+
+	data, err := router.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary error: %v", err)
+	}
+	loaded := &DomainLocationRouter{}
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary error: %v", err)
+	}
+	if got, _ := json.Marshal(loaded); string(got) != string(expected) {
+		t.Errorf("loaded router differs.\nexpected: %s\ngot: %s", expected, got)
+	}
+}
@@ -0,0 +1,261 @@
+package dlrouter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//DiffKind tells how a domain or a location differs between two routers.
+type DiffKind uint8
+
+const (
+	DiffAdded DiffKind = iota
+	DiffRemoved
+	DiffChanged
+)
+
+var diffKindNames = [...]string{
+	DiffAdded:   "added",
+	DiffRemoved: "removed",
+	DiffChanged: "changed",
+}
+
+func (k DiffKind) String() string {
+	if int(k) < len(diffKindNames) {
+		return diffKindNames[k]
+	}
+	return "unknown"
+}
+
+var diffKindSigns = [...]string{
+	DiffAdded:   "+",
+	DiffRemoved: "-",
+	DiffChanged: "~",
+}
+
+//Request is a request to route, by its domain and path.
+type Request struct {
+	Domain string
+	Path   string
+}
+
+//LocationDiff is a location of a domain added, removed, or whose targets changed.
+type LocationDiff struct {
+	Location string //the pattern: "= exact", "prefix" or "~ regex"
+	Kind     DiffKind
+	Old, New []interface{} //the targets in matching order, nil if the location is added or removed
+}
+
+//DomainDiff is a domain router added, removed, or with locations that differ.
+//The locations of an added or removed domain are all added or removed.
+type DomainDiff struct {
+	Domain    string
+	Kind      DiffKind
+	Locations []*LocationDiff //ordered by location
+
+	//the regex locations in the order they are tried, set if the regexes of both routers are tried in different orders
+	OldRegexOrder, NewRegexOrder []string
+}
+
+//RequestDiff is a request routed to different targets.
+type RequestDiff struct {
+	Request  Request
+	Old, New *Target //nil if the request is not routed
+}
+
+//RouterDiff is the semantic difference between two routers, independent of how their configurations are written.
+type RouterDiff struct {
+	Domains  []*DomainDiff //ordered by domain, the default servers by their router domains
+	Requests []*RequestDiff
+}
+
+//Diff compares the locations and their targets of the domain routers and the default servers of two routers,
+//and reports which of the samples are routed to different targets.
+func Diff(oldRouter, newRouter *DomainLocationRouter, samples ...Request) *RouterDiff {
+	oldDomains, newDomains := diffRouters(oldRouter), diffRouters(newRouter)
+	domains := make([]string, 0, len(oldDomains)+len(newDomains))
+	for domain := range oldDomains {
+		domains = append(domains, domain)
+	}
+	for domain := range newDomains {
+		if _, present := oldDomains[domain]; !present {
+			domains = append(domains, domain)
+		}
+	}
+	sort.Strings(domains)
+
+	diff := &RouterDiff{
+		Domains:  make([]*DomainDiff, 0, 4),
+		Requests: make([]*RequestDiff, 0, 4),
+	}
+	for _, domain := range domains {
+		oldDM, newDM := oldDomains[domain], newDomains[domain]
+		dd := &DomainDiff{Domain: domain, Kind: DiffChanged}
+		if oldDM == nil {
+			dd.Kind = DiffAdded
+		} else if newDM == nil {
+			dd.Kind = DiffRemoved
+		}
+		dd.Locations = diffLocations(locationTargets(oldDM), locationTargets(newDM))
+		if oldOrder, newOrder := regexOrder(oldDM), regexOrder(newDM); dd.Kind == DiffChanged && !sameRelativeOrder(oldOrder, newOrder) {
+			dd.OldRegexOrder, dd.NewRegexOrder = oldOrder, newOrder
+		}
+		if dd.Kind != DiffChanged || len(dd.Locations) > 0 || dd.OldRegexOrder != nil {
+			diff.Domains = append(diff.Domains, dd)
+		}
+	}
+
+	for _, req := range samples {
+		oldTarget, _ := oldRouter.GetTarget(req.Domain, req.Path)
+		newTarget, _ := newRouter.GetTarget(req.Domain, req.Path)
+		if oldTarget == nil && newTarget == nil {
+			continue
+		}
+		if oldTarget != nil && newTarget != nil && SameTarget(oldTarget.Value, newTarget.Value) {
+			continue
+		}
+		diff.Requests = append(diff.Requests, &RequestDiff{Request: req, Old: oldTarget, New: newTarget})
+	}
+	return diff
+}
+
+//Empty tells whether the routers do not differ.
+func (d *RouterDiff) Empty() bool {
+	return len(d.Domains) == 0 && len(d.Requests) == 0
+}
+
+//diffRouters returns the domain routers and the default server routers of a router by domain.
+func diffRouters(m *DomainLocationRouter) map[string]*DomainRouter {
+	routers := make(map[string]*DomainRouter, len(m.DomainExactSearch)+len(m.defaultServers))
+	for domain, dm := range m.DomainExactSearch {
+		routers[domain] = dm
+	}
+	for _, dm := range m.defaultServers {
+		routers[dm.Domain] = dm
+	}
+	return routers
+}
+
+//locationTargets returns the targets of every location of a domain router by pattern, nil for a nil router.
+func locationTargets(dm *DomainRouter) map[string][]interface{} {
+	if dm == nil {
+		return nil
+	}
+	locations := make(map[string][]interface{}, len(dm.LocationExactSearch)+len(dm.regexOrder)+4)
+	for location, targets := range dm.LocationExactSearch {
+		locations[exactPattern(location)] = targets
+	}
+	dm.LocationPrefixSearch.Walk(func(pattern string, values []interface{}) bool {
+		locations[pattern] = values
+		return true
+	})
+	for _, regexTar := range dm.regexOrder {
+		locations[regexPattern(regexTar.RegexExp.String())] = regexTar.Targets
+	}
+	return locations
+}
+
+//regexOrder returns the regex locations of a domain router in the order they are tried, nil for a nil router.
+func regexOrder(dm *DomainRouter) []string {
+	if dm == nil {
+		return nil
+	}
+	patterns := make([]string, 0, len(dm.regexOrder))
+	for _, regexTar := range dm.regexOrder {
+		patterns = append(patterns, regexPattern(regexTar.RegexExp.String()))
+	}
+	return patterns
+}
+
+//sameRelativeOrder tells whether the patterns present in both a and b are in the same order in both.
+//Added and removed regexes are reported as locations.
+func sameRelativeOrder(a, b []string) bool {
+	positions := make(map[string]int, len(b))
+	for i, pattern := range b {
+		positions[pattern] = i
+	}
+	last := -1
+	for _, pattern := range a {
+		pos, present := positions[pattern]
+		if !present {
+			continue
+		}
+		if pos < last {
+			return false
+		}
+		last = pos
+	}
+	return true
+}
+
+func diffLocations(oldLocations, newLocations map[string][]interface{}) []*LocationDiff {
+	patterns := make([]string, 0, len(oldLocations)+len(newLocations))
+	for pattern := range oldLocations {
+		patterns = append(patterns, pattern)
+	}
+	for pattern := range newLocations {
+		if _, present := oldLocations[pattern]; !present {
+			patterns = append(patterns, pattern)
+		}
+	}
+	sort.Strings(patterns)
+
+	diffs := make([]*LocationDiff, 0, 2)
+	for _, pattern := range patterns {
+		oldTargets, inOld := oldLocations[pattern]
+		newTargets, inNew := newLocations[pattern]
+		switch {
+		case !inOld:
+			diffs = append(diffs, &LocationDiff{Location: pattern, Kind: DiffAdded, New: newTargets})
+		case !inNew:
+			diffs = append(diffs, &LocationDiff{Location: pattern, Kind: DiffRemoved, Old: oldTargets})
+		case !sameTargets(oldTargets, newTargets):
+			diffs = append(diffs, &LocationDiff{Location: pattern, Kind: DiffChanged, Old: oldTargets, New: newTargets})
+		}
+	}
+	return diffs
+}
+
+func sameTargets(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !SameTarget(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *RouterDiff) String() string {
+	var sb strings.Builder
+	for _, dd := range d.Domains {
+		fmt.Fprintf(&sb, "%s domain %s\n", diffKindSigns[dd.Kind], dd.Domain)
+		for _, ld := range dd.Locations {
+			switch ld.Kind {
+			case DiffAdded:
+				fmt.Fprintf(&sb, "  + %s -> %v\n", ld.Location, ld.New)
+			case DiffRemoved:
+				fmt.Fprintf(&sb, "  - %s -> %v\n", ld.Location, ld.Old)
+			default:
+				fmt.Fprintf(&sb, "  ~ %s -> %v => %v\n", ld.Location, ld.Old, ld.New)
+			}
+		}
+		if dd.OldRegexOrder != nil {
+			fmt.Fprintf(&sb, "  ~ regex order %q => %q\n", dd.OldRegexOrder, dd.NewRegexOrder)
+		}
+	}
+	for _, rd := range d.Requests {
+		fmt.Fprintf(&sb, "request %s%s: %s => %s\n", rd.Request.Domain, rd.Request.Path, diffTarget(rd.Old), diffTarget(rd.New))
+	}
+	return sb.String()
+}
+
+func diffTarget(t *Target) string {
+	if t == nil {
+		return "not found"
+	}
+	return fmt.Sprintf("%v (%s)", t.Value, t.Pattern)
+}
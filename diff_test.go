@@ -0,0 +1,102 @@
+package dlrouter
+
+import (
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	oldRouter, errs := NewRouter([]*LocationConf{
+		{Target: "cart", MappingConf: []*MappingBlock{
+			{Domains: []string{"shop.com", "shop.net"}, Locations: []string{"/cart/", "= /cart"}},
+		}},
+		{Target: "legacy", MappingConf: []*MappingBlock{
+			{Domains: []string{"old.shop.com"}, Locations: []string{"/"}},
+			{Domains: []string{"shop.com"}, Locations: []string{"~ ^/v1/"}},
+		}},
+	})
+	if len(errs) > 0 {
+		t.Fatalf("NewRouter errors: %v", errs)
+	}
+	regrouped, _ := NewRouter([]*LocationConf{
+		{Target: "cart", MappingConf: []*MappingBlock{
+			{Domains: []string{"shop.net"}, Locations: []string{"= /cart", "/cart/"}},
+			{Domains: []string{"shop.com"}, Locations: []string{"/cart/"}},
+			{Domains: []string{"shop.com"}, Locations: []string{"= /cart"}},
+		}},
+		{Target: "legacy", MappingConf: []*MappingBlock{
+			{Domains: []string{"shop.com"}, Locations: []string{"~ ^/v1/"}},
+			{Domains: []string{"old.shop.com"}, Locations: []string{"/"}},
+		}},
+	})
+	if diff := Diff(oldRouter, regrouped, Request{"shop.com", "/cart/1"}); !diff.Empty() {
+		t.Errorf("regrouped blocks expected to make no difference; got:\n%s", diff)
+	}
+
+	newRouter, _ := NewRouter([]*LocationConf{
+		{Target: "cart-v2", MappingConf: []*MappingBlock{
+			{Domains: []string{"shop.com"}, Locations: []string{"/cart/"}},
+		}},
+		{Target: "cart", MappingConf: []*MappingBlock{
+			{Domains: []string{"shop.com", "shop.net"}, Locations: []string{"/cart/", "/basket/"}},
+		}},
+		{Target: "search", MappingConf: []*MappingBlock{
+			{Domains: []string{"search.shop.com"}, Locations: []string{"/"}},
+		}},
+	})
+	samples := []Request{
+		{"shop.com", "/cart/1"},
+		{"shop.net", "/cart/1"},
+		{"shop.com", "/cart"},
+		{"shop.com", "/basket/1"},
+		{"shop.com", "/v1/x"},
+		{"unknown.com", "/"},
+	}
+	diff := Diff(oldRouter, newRouter, samples...)
+	expected := `- domain old.shop.com
+  - / -> [legacy]
++ domain search.shop.com
+  + / -> [search]
+~ domain shop.com
+  + /basket/ -> [cart]
+  ~ /cart/ -> [cart] => [cart-v2 cart]
+  - = /cart -> [cart]
+  - ~ ^/v1/ -> [legacy]
+~ domain shop.net
+  + /basket/ -> [cart]
+  - = /cart -> [cart]
+request shop.com/cart/1: cart (/cart/) => cart-v2 (/cart/)
+request shop.com/cart: cart (= /cart) => not found
+request shop.com/basket/1: not found => cart (/basket/)
+request shop.com/v1/x: legacy (~ ^/v1/) => not found
+`
+	if diff.String() != expected {
+		t.Errorf("diff expected:\n%s\ngot:\n%s", expected, diff)
+	}
+	if len(diff.Domains) != 4 || diff.Domains[0].Kind != DiffRemoved || diff.Domains[1].Kind != DiffAdded {
+		t.Errorf("domain kinds expected: removed added changed changed; got: %s", diff)
+	}
+}
+
+func TestDiffRegexOrder(t *testing.T) {
+	confs := []*LocationConf{
+		{Target: "A", MappingConf: []*MappingBlock{{Domains: []string{"shop.com"}, Locations: []string{"~ ^/api/"}}}},
+		{Target: "B", MappingConf: []*MappingBlock{{Domains: []string{"shop.com"}, Locations: []string{"~ ^/api/v1/"}}}},
+	}
+	oldRouter, errs := NewRouter(confs)
+	if len(errs) > 0 {
+		t.Fatalf("NewRouter errors: %v", errs)
+	}
+	newRouter, _ := NewRouter([]*LocationConf{confs[1], confs[0]})
+
+	diff := Diff(oldRouter, newRouter, Request{"shop.com", "/api/v1/x"})
+	expected := `~ domain shop.com
+  ~ regex order ["~ ^/api/" "~ ^/api/v1/"] => ["~ ^/api/v1/" "~ ^/api/"]
+request shop.com/api/v1/x: A (~ ^/api/) => B (~ ^/api/v1/)
+`
+	if diff.String() != expected {
+		t.Errorf("diff expected:\n%s\ngot:\n%s", expected, diff)
+	}
+	if diff := Diff(oldRouter, newRouter); diff.Empty() {
+		t.Errorf("swapped regexes expected to differ without samples")
+	}
+}
@@ -0,0 +1,202 @@
+package dlrouter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/conndots/dlrouter/pathtree"
+)
+
+type domainRouterJSON struct {
+	Domain string                   `json:"domain"`
+	Exact  map[string][]interface{} `json:"exact,omitempty"`
+	Prefix *pathtree.NodeInfo       `json:"prefix"`
+	Regex  []*regexTargetJSON       `json:"regex,omitempty"`
+
+	Rewrites []*RewriteConf `json:"rewrites,omitempty"`
+}
+
+type regexTargetJSON struct {
+	Expr    string        `json:"expr"`
+	Targets []interface{} `json:"targets"`
+}
+
+type routerJSON struct {
+	Domains       []*DomainRouter    `json:"domains"`
+	PostfixSearch *pathtree.NodeInfo `json:"postfix_search"`
+	PrefixSearch  *pathtree.NodeInfo `json:"prefix_search"`
+	Routes        []*Route           `json:"routes,omitempty"`
+
+	DefaultServers []*DomainRouter `json:"default_servers,omitempty"`
+}
+
+//MarshalJSON exports the exact, prefix and regex (in configuration order) locations of the domain
+//and the rewrite rules ordered by location.
+func (dm *DomainRouter) MarshalJSON() ([]byte, error) {
+	regexes := make([]*regexTargetJSON, 0, len(dm.regexOrder))
+	for _, regexTar := range dm.regexOrder {
+		regexes = append(regexes, &regexTargetJSON{
+			Expr:    regexTar.RegexExp.String(),
+			Targets: regexTar.Targets,
+		})
+	}
+	rules := dm.rewriteRules()
+	rewrites := make([]*RewriteConf, 0, len(rules))
+	for _, rule := range rules {
+		rewrites = append(rewrites, rule.conf)
+	}
+	return json.Marshal(&domainRouterJSON{
+		Domain:   dm.Domain,
+		Exact:    dm.LocationExactSearch,
+		Prefix:   dm.LocationPrefixSearch.NodeInfo(nil),
+		Regex:    regexes,
+		Rewrites: rewrites,
+	})
+}
+
+//MarshalJSON exports the domain routers ordered by domain, the domain search trees,
+//whose values are exported as domains, the routes ordered by name and the default servers ordered by port.
+func (m *DomainLocationRouter) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&routerJSON{
+		Domains:       m.sortedDomainRouters(),
+		PostfixSearch: m.DomainPostfixSearch.NodeInfo(domainOfRouter),
+		PrefixSearch:  m.DomainPrefixSearch.NodeInfo(domainOfRouter),
+		Routes:        m.Routes(),
+
+		DefaultServers: m.DefaultServers(),
+	})
+}
+
+func domainOfRouter(value interface{}) interface{} {
+	return value.(*DomainRouter).Domain
+}
+
+func (m *DomainLocationRouter) sortedDomainRouters() []*DomainRouter {
+	routers := m.GetAllRouterInfos()
+	sort.Slice(routers, func(i, j int) bool {
+		return routers[i].Domain < routers[j].Domain
+	})
+	return routers
+}
+
+//WriteDOT writes the structure of the router as a Graphviz digraph: the domain search stages
+//leading to the domain routers, and the exact, prefix and regex locations of every domain router.
+func (m *DomainLocationRouter) WriteDOT(w io.Writer) error {
+	dw := &dotWriter{
+		w:       bufio.NewWriter(w),
+		domains: make(map[*DomainRouter]string, len(m.DomainExactSearch)),
+	}
+	routers := m.sortedDomainRouters()
+	for i, dm := range routers {
+		dw.domains[dm] = fmt.Sprintf("d%d", i)
+	}
+
+	dw.printf("digraph dlrouter {\n\trankdir=LR;\n\tnode [shape=box, fontname=\"monospace\"];\n")
+
+	dw.printf("\texact [label=\"DomainExactSearch\", shape=folder];\n")
+	for _, dm := range routers {
+		dw.printf("\texact -> %s [label=\"%s\"];\n", dw.domains[dm], dotEscape(dm.Domain))
+	}
+	dw.printf("\tpostfix [label=\"DomainPostfixSearch\\n(reversed labels)\", shape=folder];\n")
+	dw.tree("postfix", "", m.DomainPostfixSearch.NodeInfo(nil), dw.domainEdges)
+	dw.printf("\tprefix [label=\"DomainPrefixSearch\", shape=folder];\n")
+	dw.tree("prefix", "", m.DomainPrefixSearch.NodeInfo(nil), dw.domainEdges)
+
+	for _, dm := range routers {
+		id := dw.domains[dm]
+		dw.printf("\t%s [label=\"DomainRouter\\n%s\", shape=component];\n", id, dotEscape(dm.Domain))
+
+		locations := make([]string, 0, len(dm.LocationExactSearch))
+		for location := range dm.LocationExactSearch {
+			locations = append(locations, location)
+		}
+		sort.Strings(locations)
+		for _, location := range locations {
+			node := dw.nextID()
+			dw.printf("\t%s [label=\"%s\", shape=note];\n", node, dotEscape("= "+location+targetsLabel(dm.LocationExactSearch[location])))
+			dw.printf("\t%s -> %s [label=\"exact\"];\n", id, node)
+		}
+		if dm.LocationPrefixSearch.Size > 0 {
+			dw.tree(id, "prefix", dm.LocationPrefixSearch.NodeInfo(nil), func(_ string, values []interface{}) string {
+				return targetsLabel(values)
+			})
+		}
+		for _, regexTar := range dm.regexOrder {
+			node := dw.nextID()
+			dw.printf("\t%s [label=\"%s\", shape=note];\n", node, dotEscape("~ "+regexTar.RegexExp.String()+targetsLabel(regexTar.Targets)))
+			dw.printf("\t%s -> %s [label=\"regex\"];\n", id, node)
+		}
+	}
+	dw.printf("}\n")
+
+	if dw.err != nil {
+		return dw.err
+	}
+	return dw.w.Flush()
+}
+
+type dotWriter struct {
+	w       *bufio.Writer
+	err     error
+	next    int
+	domains map[*DomainRouter]string //dot node ids of the domain routers
+}
+
+func (dw *dotWriter) printf(format string, args ...interface{}) {
+	if dw.err == nil {
+		_, dw.err = fmt.Fprintf(dw.w, format, args...)
+	}
+}
+
+func (dw *dotWriter) nextID() string {
+	dw.next++
+	return fmt.Sprintf("n%d", dw.next)
+}
+
+//tree writes the nodes of a path tree below parent. valuesLabel returns the part of the label of a node
+//describing its values, and may write the edges to whatever they refer to.
+func (dw *dotWriter) tree(parent, edgeLabel string, info *pathtree.NodeInfo, valuesLabel func(node string, values []interface{}) string) {
+	node := dw.nextID()
+	label := info.Path
+	if info.NodeType == "var" {
+		vars := make([]string, 0, len(info.Vars))
+		for _, v := range info.Vars {
+			if !slices.Contains(vars, v) {
+				vars = append(vars, v)
+			}
+		}
+		label = ":" + strings.Join(vars, "|")
+	}
+	if len(info.Values) > 0 {
+		label += valuesLabel(node, info.Values)
+	}
+	dw.printf("\t%s [label=\"%s\\n(%s)\"];\n", node, dotEscape(label), info.NodeType)
+	dw.printf("\t%s -> %s [label=\"%s\"];\n", parent, node, edgeLabel)
+	for _, child := range info.Children {
+		dw.tree(node, "", child, valuesLabel)
+	}
+}
+
+func (dw *dotWriter) domainEdges(node string, values []interface{}) string {
+	for _, value := range values {
+		dw.printf("\t%s -> %s [style=dashed];\n", node, dw.domains[value.(*DomainRouter)])
+	}
+	return ""
+}
+
+func targetsLabel(targets []interface{}) string {
+	values := make([]string, 0, len(targets))
+	for _, t := range targets {
+		values = append(values, fmt.Sprint(t))
+	}
+	return "\n→ " + strings.Join(values, ", ")
+}
+
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,63 @@
+package dlrouter
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRouterJSON(t *testing.T) {
+	data, err := json.Marshal(getMappingManager())
+	if err != nil {
+		t.Fatalf("marshal json error: %v", err)
+	}
+	var exported struct {
+		Domains []struct {
+			Domain string                   `json:"domain"`
+			Exact  map[string][]interface{} `json:"exact"`
+			Regex  []struct {
+				Expr string `json:"expr"`
+			} `json:"regex"`
+		} `json:"domains"`
+		PostfixSearch map[string]interface{} `json:"postfix_search"`
+	}
+	if err := json.Unmarshal(data, &exported); err != nil {
+		t.Fatalf("unmarshal json error: %v", err)
+	}
+	if len(exported.Domains) != 15 || exported.Domains[0].Domain != "10.3.23." {
+		t.Errorf("exported domains error: %v", exported.Domains)
+	}
+	for _, dm := range exported.Domains {
+		if dm.Domain != "products.byted.org" {
+			continue
+		}
+		if len(dm.Exact["/common/api/"]) != 2 || len(dm.Regex) != 7 || dm.Regex[0].Expr != "/api/video/detail/[0-9]+" {
+			t.Errorf("exported products.byted.org error: %v", dm)
+		}
+	}
+	if exported.PostfixSearch["node_type"] != "root" {
+		t.Errorf("exported postfix search error: %v", exported.PostfixSearch)
+	}
+}
+
+func TestRouterDOT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := getMappingManager().WriteDOT(&buf); err != nil {
+		t.Fatalf("write dot error: %v", err)
+	}
+	dot := buf.String()
+	if !strings.HasPrefix(dot, "digraph dlrouter {") || !strings.HasSuffix(dot, "}\n") {
+		t.Errorf("dot graph error: %s", dot)
+	}
+	for _, expected := range []string{
+		`exact -> d14 [label="products.byted.org"];`,
+		`[label="= /common/api/\n→ 1, 2", shape=note];`,
+		`[label="~ /api/video/detail/[0-9]+\n→ 1", shape=note];`,
+		`[label=":version\n(var)"];`,
+	} {
+		if !strings.Contains(dot, expected) {
+			t.Errorf("dot graph misses %s", expected)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package dlrouter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	VersionNotFoundErr  = errors.New("[dlrouter history] version not found or no longer retained")
+	UnhashableTargetErr = errors.New("[dlrouter history] target can not be identified by its encoding")
+)
+
+//ConfigVersion is a version of the configurations applied to a ConfigStore.
+//Confs are a copy of the applied ones, sharing their targets only, and must not be modified.
+type ConfigVersion struct {
+	ID       int //increasing from 1
+	Author   string
+	Time     time.Time
+	Hash     string //hex SHA-256 of the encodings of the targets and the JSON encoding of the rest of Confs
+	Rollback int    //the ID of the version rolled back to, 0 if the version was applied
+	Confs    []*LocationConf
+}
+
+//ConfigStore keeps the live router built from the last version of the configurations applied to it,
+//and a bounded history of the previous versions to diff and roll back to.
+//Targets are identified across versions by their encoding, so distinct targets of a version must be encoded
+//differently: their JSON encoding, unless the store has a TargetCodec.
+type ConfigStore struct {
+	//TargetCodec, if set, encodes the targets instead of JSON, for targets whose JSON encoding does not tell them
+	//apart, like structs without exported fields. Equal targets must be encoded alike.
+	TargetCodec TargetCodec
+
+	limit int
+	opts  []RouterOption
+
+	mu       sync.Mutex //serializes the changes
+	versions []*ConfigVersion
+	lastID   int
+	live     atomic.Pointer[DomainLocationRouter]
+}
+
+//NewConfigStore returns a store retaining up to limit versions, the live one included.
+//The routers are built with opts.
+func NewConfigStore(limit int, opts ...RouterOption) *ConfigStore {
+	if limit < 1 {
+		limit = 1
+	}
+	return &ConfigStore{
+		limit:    limit,
+		opts:     opts,
+		versions: make([]*ConfigVersion, 0, limit),
+	}
+}
+
+//Router returns the live router, nil before the first version is applied.
+func (s *ConfigStore) Router() *DomainLocationRouter {
+	return s.live.Load()
+}
+
+//Live returns the version of the live router, nil before the first version is applied.
+func (s *ConfigStore) Live() *ConfigVersion {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.versions) == 0 {
+		return nil
+	}
+	return s.versions[len(s.versions)-1]
+}
+
+//Versions returns the retained versions, the oldest first.
+func (s *ConfigStore) Versions() []*ConfigVersion {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*ConfigVersion(nil), s.versions...)
+}
+
+//Version returns the retained version of id.
+func (s *ConfigStore) Version(id int) (*ConfigVersion, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := s.version(id)
+	return v, v != nil
+}
+
+func (s *ConfigStore) version(id int) *ConfigVersion {
+	for _, v := range s.versions {
+		if v.ID == id {
+			return v
+		}
+	}
+	return nil
+}
+
+//Apply builds a router of confs and makes it live as a new version by author. The version keeps a copy of confs,
+//so the caller may modify them afterwards; the targets are not copied. Nothing changes if confs do not compile
+//without errors, or if a target can not be encoded or is encoded as another target of confs, which are returned.
+func (s *ConfigStore) Apply(author string, confs []*LocationConf) (*ConfigVersion, []error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.apply(&ConfigVersion{Author: author, Confs: copyConfs(confs)})
+}
+
+//Rollback makes the router of the retained version of id live again, as a new version by author
+//recording the rollback.
+func (s *ConfigStore) Rollback(id int, author string) (*ConfigVersion, []error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.version(id)
+	if old == nil {
+		return nil, []error{fmt.Errorf("%w: %d", VersionNotFoundErr, id)}
+	}
+	return s.apply(&ConfigVersion{Author: author, Rollback: id, Confs: old.Confs})
+}
+
+func (s *ConfigStore) apply(v *ConfigVersion) (*ConfigVersion, []error) {
+	targets := make(map[string]interface{}, len(v.Confs))
+	for _, conf := range v.Confs {
+		key, err := s.targetKey(conf.Target)
+		if err != nil {
+			return nil, []error{err}
+		}
+		if target, present := targets[key]; present && !SameTarget(target, conf.Target) {
+			return nil, []error{fmt.Errorf("%w: targets %v and %v are encoded alike", UnhashableTargetErr, target, conf.Target)}
+		}
+		targets[key] = conf.Target
+	}
+	hash, err := s.confsHash(v.Confs)
+	if err != nil {
+		return nil, []error{err}
+	}
+	router, errs := NewRouter(v.Confs, s.opts...)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	s.lastID++
+	v.ID = s.lastID
+	v.Time = time.Now()
+	v.Hash = hash
+
+	if len(s.versions) == s.limit {
+		copy(s.versions, s.versions[1:])
+		s.versions = s.versions[:len(s.versions)-1]
+	}
+	s.versions = append(s.versions, v)
+	s.live.Store(router)
+	return v, nil
+}
+
+//copyConfs copies confs and their blocks, but not their targets.
+func copyConfs(confs []*LocationConf) []*LocationConf {
+	copied := make([]*LocationConf, len(confs))
+	for i, conf := range confs {
+		if conf == nil {
+			continue
+		}
+		c := *conf
+		c.MappingConf = make([]*MappingBlock, len(conf.MappingConf))
+		for j, block := range conf.MappingConf {
+			if block == nil {
+				continue
+			}
+			b := *block
+			b.Domains = append([]string(nil), block.Domains...)
+			b.Locations = append([]string(nil), block.Locations...)
+			b.DefaultPorts = append([]int(nil), block.DefaultPorts...)
+			b.LocationPos = append([]SourcePos(nil), block.LocationPos...)
+			if block.Names != nil {
+				b.Names = make(map[string]string, len(block.Names))
+				for name, location := range block.Names {
+					b.Names[name] = location
+				}
+			}
+			if block.Rewrites != nil {
+				b.Rewrites = make([]*RewriteConf, len(block.Rewrites))
+				for k, rw := range block.Rewrites {
+					r := *rw
+					b.Rewrites[k] = &r
+				}
+			}
+			c.MappingConf[j] = &b
+		}
+		copied[i] = &c
+	}
+	return copied
+}
+
+//confsHash hashes the encodings of the targets of confs and the JSON encoding of the rest of confs,
+//which are deterministic. It returns UnhashableTargetErr if a target is not encodable, like a func or a chan in JSON.
+func (s *ConfigStore) confsHash(confs []*LocationConf) (string, error) {
+	h := sha256.New()
+	for _, conf := range confs {
+		key, err := s.targetKey(conf.Target)
+		if err != nil {
+			return "", err
+		}
+		c := *conf
+		c.Target = nil
+		data, err := json.Marshal(&c)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%d:%s%d:%s", len(key), key, len(data), data)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+//ConfChange is the change of the LocationConf of a target between two versions.
+type ConfChange struct {
+	Target   interface{}
+	Old, New *LocationConf //nil if the target is added or removed
+	Added    []string      //the locations of the target added, as "domain location"
+	Removed  []string      //the locations of the target removed, as "domain location"
+}
+
+//ConfigDiff lists the targets whose configuration differs between two versions.
+type ConfigDiff struct {
+	From, To int
+	Changes  []*ConfChange
+}
+
+//Diff compares the configurations of the retained versions from and to, target by target.
+//The changes are ordered as the targets in to, then the removed targets as in from.
+func (s *ConfigStore) Diff(from, to int) (*ConfigDiff, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vFrom, vTo := s.version(from), s.version(to)
+	if vFrom == nil {
+		return nil, fmt.Errorf("%w: %d", VersionNotFoundErr, from)
+	}
+	if vTo == nil {
+		return nil, fmt.Errorf("%w: %d", VersionNotFoundErr, to)
+	}
+	changes, err := s.diffConfs(vFrom.Confs, vTo.Confs)
+	if err != nil {
+		return nil, err
+	}
+	return &ConfigDiff{From: from, To: to, Changes: changes}, nil
+}
+
+//targetKey identifies a target across versions by its encoding.
+func (s *ConfigStore) targetKey(target interface{}) (string, error) {
+	var data []byte
+	var err error
+	if s.TargetCodec != nil {
+		data, err = s.TargetCodec.EncodeTarget(target)
+	} else {
+		data, err = json.Marshal(target)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", UnhashableTargetErr, err)
+	}
+	return string(data), nil
+}
+
+//targetConfs groups the confs of a version by target, merging the confs of a target used by several of them.
+//The keys of the targets are returned in the order of their first confs.
+func (s *ConfigStore) targetConfs(confs []*LocationConf) ([]string, map[string]*LocationConf, map[string]string, error) {
+	keys := make([]string, 0, len(confs))
+	groups := make(map[string][]*LocationConf, len(confs))
+	for _, conf := range confs {
+		key, err := s.targetKey(conf.Target)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if _, present := groups[key]; !present {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], conf)
+	}
+	merged := make(map[string]*LocationConf, len(keys))
+	hashes := make(map[string]string, len(keys))
+	for _, key := range keys {
+		hash, err := s.confsHash(groups[key])
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		merged[key], hashes[key] = mergeConfs(groups[key]), hash
+	}
+	return keys, merged, hashes, nil
+}
+
+//mergeConfs merges the confs of a target into one, the priority of every conf moved to its blocks.
+func mergeConfs(confs []*LocationConf) *LocationConf {
+	if len(confs) == 1 {
+		return confs[0]
+	}
+	merged := &LocationConf{Target: confs[0].Target, MappingConf: make([]*MappingBlock, 0, len(confs))}
+	for _, conf := range confs {
+		for _, block := range conf.MappingConf {
+			b := *block
+			b.Priority = block.priority(conf.Priority)
+			merged.MappingConf = append(merged.MappingConf, &b)
+		}
+	}
+	return merged
+}
+
+func (s *ConfigStore) diffConfs(oldConfs, newConfs []*LocationConf) ([]*ConfChange, error) {
+	oldKeys, olds, oldHashes, err := s.targetConfs(oldConfs)
+	if err != nil {
+		return nil, err
+	}
+	newKeys, news, newHashes, err := s.targetConfs(newConfs)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]*ConfChange, 0, 4)
+	for _, key := range newKeys {
+		if old, present := olds[key]; !present || oldHashes[key] != newHashes[key] {
+			changes = append(changes, newConfChange(old, news[key]))
+		}
+	}
+	for _, key := range oldKeys {
+		if _, present := news[key]; !present {
+			changes = append(changes, newConfChange(olds[key], nil))
+		}
+	}
+	return changes, nil
+}
+
+func newConfChange(oldConf, newConf *LocationConf) *ConfChange {
+	change := &ConfChange{Old: oldConf, New: newConf}
+	var oldLocations, newLocations []string
+	if oldConf != nil {
+		change.Target = oldConf.Target
+		oldLocations = confLocations(oldConf)
+	}
+	if newConf != nil {
+		change.Target = newConf.Target
+		newLocations = confLocations(newConf)
+	}
+	for _, l := range newLocations {
+		if !slices.Contains(oldLocations, l) {
+			change.Added = append(change.Added, l)
+		}
+	}
+	for _, l := range oldLocations {
+		if !slices.Contains(newLocations, l) {
+			change.Removed = append(change.Removed, l)
+		}
+	}
+	return change
+}
+
+//confLocations returns the sorted "domain location" pairs of a conf, the default servers by their router domain.
+func confLocations(conf *LocationConf) []string {
+	locations := make([]string, 0, 8)
+	add := func(domain string, block *MappingBlock) {
+		for _, location := range block.Locations {
+			l := domain + " " + normalizeLocation(location)
+			if !slices.Contains(locations, l) {
+				locations = append(locations, l)
+			}
+		}
+	}
+	for _, block := range conf.MappingConf {
+		for _, domain := range block.Domains {
+			add(domain, block)
+		}
+		if !block.DefaultServer {
+			continue
+		}
+		if len(block.DefaultPorts) == 0 {
+			add(DefaultServerDomain, block)
+		}
+		for _, port := range block.DefaultPorts {
+			add(defaultServerDomain(port), block)
+		}
+	}
+	sort.Strings(locations)
+	return locations
+}
+
+func (d *ConfigDiff) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "version %d -> %d", d.From, d.To)
+	for _, change := range d.Changes {
+		switch {
+		case change.Old == nil:
+			fmt.Fprintf(&sb, "\n+ %v", change.Target)
+		case change.New == nil:
+			fmt.Fprintf(&sb, "\n- %v", change.Target)
+		default:
+			fmt.Fprintf(&sb, "\n~ %v", change.Target)
+		}
+		for _, l := range change.Removed {
+			fmt.Fprintf(&sb, "\n  - %s", l)
+		}
+		for _, l := range change.Added {
+			fmt.Fprintf(&sb, "\n  + %s", l)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,182 @@
+package dlrouter
+
+import (
+	"errors"
+	"testing"
+)
+
+func getHistoryConfs(cartLocations ...string) []*LocationConf {
+	return []*LocationConf{
+		{Target: "cart", MappingConf: []*MappingBlock{{Domains: []string{"shop.com"}, Locations: cartLocations}}},
+		{Target: "home", MappingConf: []*MappingBlock{{Domains: []string{"shop.com"}, Locations: []string{"= /"}}}},
+	}
+}
+
+func TestConfigStore(t *testing.T) {
+	store := NewConfigStore(3)
+	if store.Router() != nil || store.Live() != nil {
+		t.Errorf("empty store expected")
+	}
+
+	v1, errs := store.Apply("alice", getHistoryConfs("/cart/"))
+	if len(errs) > 0 || v1.ID != 1 || v1.Author != "alice" || len(v1.Hash) != 64 {
+		t.Fatalf("version 1 expected; got: %+v, %v", v1, errs)
+	}
+	if _, errs := store.Apply("bob", getHistoryConfs("~ (")); len(errs) == 0 || store.Live() != v1 {
+		t.Errorf("a broken configuration must not be applied; got: %v", errs)
+	}
+
+	confs := append(getHistoryConfs("/basket/", "= /cart"), &LocationConf{
+		Target:      "search",
+		MappingConf: []*MappingBlock{{Domains: []string{"shop.com"}, Locations: []string{"/search/"}}},
+	})
+	v2, errs := store.Apply("bob", confs[1:])
+	if len(errs) > 0 || v2.ID != 2 {
+		t.Fatalf("version 2 expected; got: %+v, %v", v2, errs)
+	}
+	v3, _ := store.Apply("bob", confs)
+	if target, _ := store.Router().GetTarget("shop.com", "/basket/1"); target == nil || target.Value != "cart" {
+		t.Errorf("target of the live router expected: cart; got: %v", target)
+	}
+
+	diff, err := store.Diff(v1.ID, v3.ID)
+	if err != nil {
+		t.Fatalf("Diff error: %v", err)
+	}
+	expected := `version 1 -> 3
+~ cart
+  - shop.com /cart/
+  + shop.com /basket/
+  + shop.com = /cart
++ search
+  + shop.com /search/`
+	if diff.String() != expected {
+		t.Errorf("diff expected:\n%s\ngot:\n%s", expected, diff)
+	}
+	if diff, _ := store.Diff(v3.ID, v2.ID); len(diff.Changes) != 1 || diff.Changes[0].New != nil {
+		t.Errorf("removal of cart expected; got: %s", diff)
+	}
+
+	v4, errs := store.Rollback(v1.ID, "carol")
+	if len(errs) > 0 || v4.ID != 4 || v4.Rollback != v1.ID || v4.Hash != v1.Hash || store.Live() != v4 {
+		t.Fatalf("rollback to version 1 expected; got: %+v, %v", v4, errs)
+	}
+	if target, _ := store.Router().GetTarget("shop.com", "/cart/1"); target == nil || target.Value != "cart" {
+		t.Errorf("target of the rolled back router expected: cart; got: %v", target)
+	}
+
+	if versions := store.Versions(); len(versions) != 3 || versions[0] != v2 {
+		t.Errorf("versions [2 3 4] expected; got: %v", versions)
+	}
+	if _, err := store.Diff(v1.ID, v4.ID); !errors.Is(err, VersionNotFoundErr) {
+		t.Errorf("error expected: %v; got: %v", VersionNotFoundErr, err)
+	}
+	if _, errs := store.Rollback(v1.ID, "carol"); len(errs) != 1 || !errors.Is(errs[0], VersionNotFoundErr) {
+		t.Errorf("error expected: %v; got: %v", VersionNotFoundErr, errs)
+	}
+}
+
+func TestConfigStoreHash(t *testing.T) {
+	store := NewConfigStore(3)
+	type backend struct{ Name string }
+	for _, author := range []string{"alice", "bob"} {
+		confs := []*LocationConf{{Target: &backend{"cart"}, MappingConf: []*MappingBlock{{Domains: []string{"shop.com"}, Locations: []string{"/cart/"}}}}}
+		if _, errs := store.Apply(author, confs); len(errs) > 0 {
+			t.Fatalf("Apply errors: %v", errs)
+		}
+	}
+	if diff, err := store.Diff(1, 2); err != nil || len(diff.Changes) != 0 {
+		t.Errorf("identical confs with pointer targets expected no change; got: %v, %v", diff, err)
+	}
+	if store.versions[0].Hash != store.versions[1].Hash {
+		t.Errorf("identical confs expected the same hash; got: %s and %s", store.versions[0].Hash, store.versions[1].Hash)
+	}
+
+	confs := []*LocationConf{{Target: func() {}, MappingConf: []*MappingBlock{{Domains: []string{"shop.com"}, Locations: []string{"/f/"}}}}}
+	if _, errs := store.Apply("carol", confs); len(errs) != 1 || !errors.Is(errs[0], UnhashableTargetErr) {
+		t.Errorf("unhashable target error expected; got: %v", errs)
+	}
+	if store.Live().ID != 2 {
+		t.Errorf("live version expected: 2; got: %d", store.Live().ID)
+	}
+}
+
+func TestConfigStoreCopiesConfs(t *testing.T) {
+	store := NewConfigStore(3)
+	confs := getHistoryConfs("/cart/")
+	v1, errs := store.Apply("alice", confs)
+	if len(errs) > 0 {
+		t.Fatalf("Apply errors: %v", errs)
+	}
+	confs[0].MappingConf[0].Locations[0] = "/basket/"
+	if location := v1.Confs[0].MappingConf[0].Locations[0]; location != "/cart/" {
+		t.Errorf("version 1 location expected: /cart/; got: %s", location)
+	}
+	if _, errs := store.Apply("alice", confs); len(errs) > 0 {
+		t.Fatalf("Apply errors: %v", errs)
+	}
+	diff, err := store.Diff(1, 2)
+	if err != nil || len(diff.Changes) != 1 || len(diff.Changes[0].Added) != 1 || diff.Changes[0].Added[0] != "shop.com /basket/" {
+		t.Errorf("diff expected: + shop.com /basket/; got: %v, %v", diff, err)
+	}
+}
+
+type opaqueBackend struct {
+	name string
+}
+
+type opaqueCodec struct{}
+
+func (opaqueCodec) EncodeTarget(target interface{}) ([]byte, error) {
+	return []byte(target.(opaqueBackend).name), nil
+}
+
+func (opaqueCodec) DecodeTarget(data []byte) (interface{}, error) {
+	return opaqueBackend{string(data)}, nil
+}
+
+func TestConfigStoreTargetCodec(t *testing.T) {
+	getConfs := func(names ...string) []*LocationConf {
+		confs := make([]*LocationConf, 0, len(names))
+		for _, name := range names {
+			confs = append(confs, &LocationConf{Target: opaqueBackend{name}, MappingConf: []*MappingBlock{{Domains: []string{name + ".com"}, Locations: []string{"/"}}}})
+		}
+		return confs
+	}
+
+	//the JSON encoding of the targets is {} for both
+	store := NewConfigStore(3)
+	if _, errs := store.Apply("alice", getConfs("cart", "search")); len(errs) != 1 || !errors.Is(errs[0], UnhashableTargetErr) {
+		t.Errorf("error expected for targets encoded alike; got: %v", errs)
+	}
+
+	store.TargetCodec = opaqueCodec{}
+	if _, errs := store.Apply("alice", getConfs("cart", "search")); len(errs) > 0 {
+		t.Fatalf("Apply errors: %v", errs)
+	}
+	confs := getConfs("cart", "search")
+	confs[1].Target = opaqueBackend{"basket"}
+	if _, errs := store.Apply("bob", confs); len(errs) > 0 {
+		t.Fatalf("Apply errors: %v", errs)
+	}
+	if store.versions[0].Hash == store.versions[1].Hash {
+		t.Errorf("versions with different targets expected different hashes")
+	}
+	diff, err := store.Diff(1, 2)
+	expected := "version 1 -> 2\n+ {basket}\n  + search.com /\n- {search}\n  - search.com /"
+	if err != nil || diff.String() != expected {
+		t.Errorf("diff expected:\n%s\ngot:\n%v %v", expected, diff, err)
+	}
+
+	//a target used by several confs
+	confs = getConfs("cart", "search", "cart")
+	confs[2].MappingConf[0].Domains[0] = "shop.com"
+	if _, errs := store.Apply("carol", confs); len(errs) > 0 {
+		t.Fatalf("Apply errors: %v", errs)
+	}
+	diff, err = store.Diff(2, 3)
+	expected = "version 2 -> 3\n~ {cart}\n  + shop.com /\n+ {search}\n  + search.com /\n- {basket}\n  - search.com /"
+	if err != nil || diff.String() != expected {
+		t.Errorf("diff expected:\n%s\ngot:\n%v %v", expected, diff, err)
+	}
+}
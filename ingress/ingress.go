@@ -0,0 +1,322 @@
+//Package ingress imports Kubernetes networking.k8s.io/v1 Ingress manifests as dlrouter location configurations.
+//
+//Every rule host becomes a domain, wildcard hosts like *.example.com the domain postfix .example.com.
+//The domains match more hosts than the rules do, which is warned about for every rule: the domain example.com
+//also matches its subdomains, found by the postfix stage of the domain search, and the hosts starting with it,
+//like example.com.evil, found by its prefix stage. The domain postfix .example.com matches the subdomains of
+//example.com at any depth, where Kubernetes matches a single label.
+//Exact paths become "=" locations, Prefix paths an exact location of the path plus a prefix location of the path
+//ending with "/", to match whole path elements only, and ImplementationSpecific paths regex locations matching the
+//path literally at the start of the path. Each service backend becomes the target of a LocationConf.
+//Exact and Prefix paths containing ':', which starts a path variable in dlrouter, are skipped with a warning.
+//
+//As dlrouter tries the regex locations of a domain only when no prefix location matches, an ImplementationSpecific
+//path is only reached for the paths not covered by the Prefix paths of its host.
+package ingress
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/conndots/dlrouter"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	PathTypeExact                  = "Exact"
+	PathTypePrefix                 = "Prefix"
+	PathTypeImplementationSpecific = "ImplementationSpecific"
+)
+
+var (
+	//annotations without any effect on routing, which are not warned about
+	ignoredAnnotations = map[string]bool{
+		"kubernetes.io/ingress.class":                      true,
+		"kubectl.kubernetes.io/last-applied-configuration": true,
+	}
+)
+
+//Backend is the target of the locations imported from the paths of an Ingress.
+type Backend struct {
+	Namespace string
+	Service   string
+	Port      string //the port number or name
+}
+
+func (b Backend) String() string {
+	return fmt.Sprintf("%s/%s:%s", b.Namespace, b.Service, b.Port)
+}
+
+//Warning reports a part of an Ingress which is not imported, or not imported faithfully.
+type Warning struct {
+	Pos     dlrouter.SourcePos
+	Ingress string //namespace/name
+	Message string
+}
+
+func (w *Warning) String() string {
+	return fmt.Sprintf("%s: ingress %s: %s", w.Pos, w.Ingress, w.Message)
+}
+
+type manifest struct {
+	APIVersion string      `yaml:"apiVersion"`
+	Kind       string      `yaml:"kind"`
+	Metadata   metadata    `yaml:"metadata"`
+	Spec       ingressSpec `yaml:"spec"`
+	Items      []manifest  `yaml:"items"`
+}
+
+type metadata struct {
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+type ingressSpec struct {
+	DefaultBackend *backend `yaml:"defaultBackend"`
+	Rules          []rule   `yaml:"rules"`
+}
+
+type rule struct {
+	Host string `yaml:"host"`
+	HTTP *struct {
+		Paths []httpPath `yaml:"paths"`
+	} `yaml:"http"`
+}
+
+type httpPath struct {
+	Path     string  `yaml:"path"`
+	PathType string  `yaml:"pathType"`
+	Backend  backend `yaml:"backend"`
+}
+
+type backend struct {
+	Service *struct {
+		Name string `yaml:"name"`
+		Port struct {
+			Number int    `yaml:"number"`
+			Name   string `yaml:"name"`
+		} `yaml:"port"`
+	} `yaml:"service"`
+	Resource *struct {
+		Kind string `yaml:"kind"`
+		Name string `yaml:"name"`
+	} `yaml:"resource"`
+}
+
+//Importer collects the locations of Ingress manifests, one LocationConf per backend.
+type Importer struct {
+	confs    []*dlrouter.LocationConf
+	backends map[Backend]*dlrouter.LocationConf
+	warnings []*Warning
+}
+
+func NewImporter() *Importer {
+	return &Importer{
+		confs:    make([]*dlrouter.LocationConf, 0, 4),
+		backends: make(map[Backend]*dlrouter.LocationConf, 4),
+		warnings: make([]*Warning, 0, 2),
+	}
+}
+
+//LoadFiles imports the Ingress manifests of the YAML files, which may contain several documents.
+func LoadFiles(filenames ...string) ([]*dlrouter.LocationConf, []*Warning, error) {
+	im := NewImporter()
+	for _, filename := range filenames {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := im.Parse(filename, data); err != nil {
+			return nil, nil, err
+		}
+	}
+	return im.Confs(), im.Warnings(), nil
+}
+
+//LoadDir imports the Ingress manifests of the .yaml and .yml files of dir.
+func LoadDir(dir string) ([]*dlrouter.LocationConf, []*Warning, error) {
+	filenames := make([]string, 0, 8)
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, nil, err
+		}
+		filenames = append(filenames, matches...)
+	}
+	return LoadFiles(filenames...)
+}
+
+//Confs returns the configurations of the backends in the order they were first seen.
+func (im *Importer) Confs() []*dlrouter.LocationConf {
+	return im.confs
+}
+
+func (im *Importer) Warnings() []*Warning {
+	return im.warnings
+}
+
+//Parse imports the Ingress manifests of data. Documents of other kinds are skipped.
+func (im *Importer) Parse(filename string, data []byte) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc manifest
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("[dlrouter ingress] parse %s: %v", filename, err)
+		}
+		im.add(filename, &doc)
+	}
+}
+
+func (im *Importer) add(filename string, doc *manifest) {
+	if strings.HasSuffix(doc.Kind, "List") {
+		for i := range doc.Items {
+			im.add(filename, &doc.Items[i])
+		}
+		return
+	}
+	if doc.Kind != "Ingress" {
+		return
+	}
+
+	namespace := doc.Metadata.Namespace
+	if len(namespace) == 0 {
+		namespace = "default"
+	}
+	warn := func(format string, args ...interface{}) {
+		im.warnings = append(im.warnings, &Warning{
+			Pos:     dlrouter.SourcePos{File: filename},
+			Ingress: namespace + "/" + doc.Metadata.Name,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if doc.APIVersion != "networking.k8s.io/v1" {
+		warn("api version %s is not supported", doc.APIVersion)
+		return
+	}
+	annotations := make([]string, 0, len(doc.Metadata.Annotations))
+	for name := range doc.Metadata.Annotations {
+		if !ignoredAnnotations[name] {
+			annotations = append(annotations, name)
+		}
+	}
+	sort.Strings(annotations)
+	for _, name := range annotations {
+		warn("annotation %s is not supported", name)
+	}
+	if doc.Spec.DefaultBackend != nil {
+		warn("the default backend is not supported")
+	}
+
+	for _, r := range doc.Spec.Rules {
+		if len(r.Host) == 0 {
+			warn("rules without host are not supported")
+			continue
+		}
+		if r.HTTP == nil {
+			continue
+		}
+		domain := r.Host
+		if strings.HasPrefix(domain, "*.") {
+			domain = domain[1:]
+			warn("host %s matches the subdomains of %s at any depth in dlrouter", r.Host, domain[1:])
+		} else {
+			warn("host %s also matches its subdomains and the hosts starting with it in dlrouter", r.Host)
+		}
+
+		for _, p := range r.HTTP.Paths {
+			if p.Backend.Service == nil {
+				warn("path %s of host %s: only service backends are supported", p.Path, r.Host)
+				continue
+			}
+			if strings.IndexByte(p.Path, ':') >= 0 && p.PathType != PathTypeImplementationSpecific {
+				warn("path %s of host %s: ':' starts a path variable in dlrouter, the path is skipped", p.Path, r.Host)
+				continue
+			}
+			locations, err := getLocations(p.Path, p.PathType)
+			if err != nil {
+				warn("path %s of host %s: %v", p.Path, r.Host, err)
+				continue
+			}
+
+			target := Backend{
+				Namespace: namespace,
+				Service:   p.Backend.Service.Name,
+				Port:      p.Backend.Service.Port.Name,
+			}
+			if p.Backend.Service.Port.Number > 0 {
+				target.Port = fmt.Sprint(p.Backend.Service.Port.Number)
+			}
+			im.addLocations(target, domain, filename, locations)
+		}
+	}
+}
+
+func getLocations(path, pathType string) ([]string, error) {
+	if len(path) == 0 {
+		path = "/"
+	}
+	switch pathType {
+	case PathTypeExact:
+		return []string{"= " + path}, nil
+	case PathTypePrefix:
+		//Prefix matches whole path elements, ignoring a trailing slash
+		path = strings.TrimSuffix(path, "/")
+		if len(path) == 0 {
+			return []string{"/"}, nil
+		}
+		return []string{"= " + path, path + "/"}, nil
+	case PathTypeImplementationSpecific:
+		return []string{"~ ^" + regexp.QuoteMeta(path)}, nil
+	default:
+		return nil, fmt.Errorf("path type %q is not supported", pathType)
+	}
+}
+
+//addLocations adds the locations to the block of domain in the configuration of target
+func (im *Importer) addLocations(target Backend, domain, filename string, locations []string) {
+	conf, present := im.backends[target]
+	if !present {
+		conf = &dlrouter.LocationConf{
+			Target:      target,
+			MappingConf: make([]*dlrouter.MappingBlock, 0, 2),
+		}
+		im.backends[target] = conf
+		im.confs = append(im.confs, conf)
+	}
+
+	var block *dlrouter.MappingBlock
+	for _, b := range conf.MappingConf {
+		if b.Domains[0] == domain {
+			block = b
+			break
+		}
+	}
+	if block == nil {
+		block = &dlrouter.MappingBlock{
+			Domains:   []string{domain},
+			Locations: make([]string, 0, len(locations)),
+			Pos:       dlrouter.SourcePos{File: filename},
+		}
+		conf.MappingConf = append(conf.MappingConf, block)
+	}
+	for _, location := range locations {
+		if !slices.Contains(block.Locations, location) {
+			block.Locations = append(block.Locations, location)
+		}
+	}
+}
+
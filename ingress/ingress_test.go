@@ -0,0 +1,189 @@
+package ingress
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/conndots/dlrouter"
+)
+
+const manifests = `apiVersion: v1
+kind: Service
+metadata:
+  name: api
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: shop
+  namespace: web
+  annotations:
+    kubernetes.io/ingress.class: nginx
+    nginx.ingress.kubernetes.io/rewrite-target: /
+spec:
+  rules:
+  - host: shop.example.com
+    http:
+      paths:
+      - path: /api
+        pathType: Prefix
+        backend:
+          service:
+            name: api
+            port:
+              number: 8080
+      - path: /healthz
+        pathType: Exact
+        backend:
+          service:
+            name: api
+            port:
+              number: 8080
+      - path: /static/v1.0/(css)
+        pathType: ImplementationSpecific
+        backend:
+          service:
+            name: assets
+            port:
+              name: http
+      - path: /users/:id
+        pathType: Exact
+        backend:
+          service:
+            name: api
+            port:
+              number: 8080
+      - path: /
+        pathType: Prefix
+        backend:
+          service:
+            name: frontend
+            port:
+              number: 80
+  - host: "*.cdn.example.com"
+    http:
+      paths:
+      - path: /
+        pathType: Prefix
+        backend:
+          resource:
+            kind: StorageBucket
+            name: assets
+      - path: /img/
+        pathType: Prefix
+        backend:
+          service:
+            name: assets
+            port:
+              name: http
+  - http:
+      paths:
+      - path: /
+        pathType: Prefix
+        backend:
+          service:
+            name: frontend
+            port:
+              number: 80
+`
+
+func TestLoadFiles(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "shop.yaml")
+	if err := os.WriteFile(filename, []byte(manifests), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	confs, warnings, err := LoadDir(dir)
+	if err != nil {
+		t.Fatalf("LoadDir error: %v", err)
+	}
+	if len(confs) != 3 {
+		t.Fatalf("conf number expected: 3; got: %d", len(confs))
+	}
+	expectedLocations := map[Backend][]string{
+		{"web", "api", "8080"}:    {"= /api", "/api/", "= /healthz"},
+		{"web", "assets", "http"}: {"~ ^/static/v1\\.0/\\(css\\)"},
+		{"web", "frontend", "80"}: {"/"},
+	}
+	for _, conf := range confs {
+		backend := conf.Target.(Backend)
+		if !reflect.DeepEqual(conf.MappingConf[0].Locations, expectedLocations[backend]) {
+			t.Errorf("locations of %v expected: %v; got: %v", backend, expectedLocations[backend], conf.MappingConf[0].Locations)
+		}
+	}
+	assets := confs[1]
+	if len(assets.MappingConf) != 2 || assets.MappingConf[1].Domains[0] != ".cdn.example.com" {
+		t.Errorf("wildcard host of %v expected as domain postfix .cdn.example.com", assets.Target)
+	}
+
+	expectedWarnings := []string{
+		filename + ": ingress web/shop: annotation nginx.ingress.kubernetes.io/rewrite-target is not supported",
+		filename + ": ingress web/shop: host shop.example.com also matches its subdomains and the hosts starting with it in dlrouter",
+		filename + ": ingress web/shop: path /users/:id of host shop.example.com: ':' starts a path variable in dlrouter, the path is skipped",
+		filename + ": ingress web/shop: host *.cdn.example.com matches the subdomains of cdn.example.com at any depth in dlrouter",
+		filename + ": ingress web/shop: path / of host *.cdn.example.com: only service backends are supported",
+		filename + ": ingress web/shop: rules without host are not supported",
+	}
+	if len(warnings) != len(expectedWarnings) {
+		t.Fatalf("warnings expected: %v; got: %v", expectedWarnings, warnings)
+	}
+	for i, w := range warnings {
+		if w.String() != expectedWarnings[i] {
+			t.Errorf("warning expected: %s; got: %s", expectedWarnings[i], w)
+		}
+	}
+
+	router, errs := dlrouter.NewRouter(confs)
+	if len(errs) > 0 {
+		t.Fatalf("NewRouter errors: %v", errs)
+	}
+	requests := []struct {
+		domain, path string
+		target       interface{}
+	}{
+		{"shop.example.com", "/api", Backend{"web", "api", "8080"}},
+		{"shop.example.com", "/api/orders", Backend{"web", "api", "8080"}},
+		{"shop.example.com", "/apis", Backend{"web", "frontend", "80"}},
+		{"shop.example.com", "/healthz", Backend{"web", "api", "8080"}},
+		{"shop.example.com", "/static/site.css", Backend{"web", "frontend", "80"}}, //prefix locations take precedence
+		{"a.cdn.example.com", "/img/logo.png", Backend{"web", "assets", "http"}},
+		//wider than the rules, as warned
+		{"a.b.cdn.example.com", "/img/logo.png", Backend{"web", "assets", "http"}},
+		{"www.shop.example.com", "/", Backend{"web", "frontend", "80"}},
+		{"shop.example.com.evil", "/", Backend{"web", "frontend", "80"}},
+	}
+	for _, req := range requests {
+		target, found := router.GetTarget(req.domain, req.path)
+		if !found || target.Value != req.target {
+			t.Errorf("target of %s%s expected: %v; got: %v", req.domain, req.path, req.target, target)
+		}
+	}
+}
+
+func TestImplementationSpecificLiteral(t *testing.T) {
+	locations, err := getLocations("/v1.0/(css)[", PathTypeImplementationSpecific)
+	if err != nil {
+		t.Fatalf("getLocations error: %v", err)
+	}
+	router, errs := dlrouter.NewRouter([]*dlrouter.LocationConf{{
+		Target:      "assets",
+		MappingConf: []*dlrouter.MappingBlock{{Domains: []string{"example.com"}, Locations: locations}},
+	}})
+	if len(errs) > 0 {
+		t.Fatalf("NewRouter errors: %v", errs)
+	}
+	paths := map[string]bool{
+		"/v1.0/(css)[":       true,
+		"/v1.0/(css)[/a.css": true,
+		"/v1x0/(css)[":       false,
+		"/v1.0/css[":         false,
+	}
+	for path, expected := range paths {
+		if _, found := router.GetTarget("example.com", path); found != expected {
+			t.Errorf("match of %s expected: %v; got: %v", path, expected, found)
+		}
+	}
+}
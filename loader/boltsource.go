@@ -0,0 +1,131 @@
+package loader
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/conndots/dlrouter"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltConfsBucket = []byte("confs")
+	boltMetaBucket  = []byte("meta")
+	boltRevisionKey = []byte("revision")
+)
+
+//BoltSource is a ConfigSource embedded in a bbolt database file, storing the configurations as JSON.
+//Targets are restored as JSON decodes them into an interface{}.
+//The file is locked by the process which opened it, so only its own changes are watched.
+type BoltSource struct {
+	db       *bolt.DB
+	notifier *revisionNotifier
+}
+
+//OpenBoltSource opens the database file path, creating it if it does not exist.
+func OpenBoltSource(path string) (*BoltSource, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("[dlrouter loader] open %s: %w", path, err)
+	}
+	var rev int64
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(boltConfsBucket); err != nil {
+			return err
+		}
+		meta, err := tx.CreateBucketIfNotExists(boltMetaBucket)
+		if err != nil {
+			return err
+		}
+		rev = boltRevision(meta)
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("[dlrouter loader] open %s: %w", path, err)
+	}
+	return &BoltSource{db: db, notifier: newRevisionNotifier(rev)}, nil
+}
+
+func boltRevision(meta *bolt.Bucket) int64 {
+	if data := meta.Get(boltRevisionKey); len(data) == 8 {
+		return int64(binary.BigEndian.Uint64(data))
+	}
+	return 0
+}
+
+func (bs *BoltSource) Close() error {
+	return bs.db.Close()
+}
+
+func (bs *BoltSource) List(ctx context.Context) ([]*dlrouter.LocationConf, int64, error) {
+	confs := make([]*dlrouter.LocationConf, 0, 8)
+	var rev int64
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		rev = boltRevision(tx.Bucket(boltMetaBucket))
+		return tx.Bucket(boltConfsBucket).ForEach(func(key, data []byte) error {
+			conf := &dlrouter.LocationConf{}
+			if err := json.Unmarshal(data, conf); err != nil {
+				return fmt.Errorf("[dlrouter loader] decode %s: %w", key, err)
+			}
+			confs = append(confs, conf)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return confs, rev, nil
+}
+
+func (bs *BoltSource) Watch(ctx context.Context, rev int64) <-chan int64 {
+	return bs.notifier.watch(ctx, rev)
+}
+
+//Put stores conf by key, and returns the new revision.
+func (bs *BoltSource) Put(key string, conf *dlrouter.LocationConf) (int64, error) {
+	data, err := json.Marshal(conf)
+	if err != nil {
+		return 0, fmt.Errorf("[dlrouter loader] encode %s: %w", key, err)
+	}
+	return bs.update(func(confs *bolt.Bucket) (bool, error) {
+		return true, confs.Put([]byte(key), data)
+	})
+}
+
+//Delete removes the configuration of key, and returns the new revision.
+//The revision is unchanged if there is no configuration of key.
+func (bs *BoltSource) Delete(key string) (int64, error) {
+	return bs.update(func(confs *bolt.Bucket) (bool, error) {
+		if confs.Get([]byte(key)) == nil {
+			return false, nil
+		}
+		return true, confs.Delete([]byte(key))
+	})
+}
+
+//update changes the configurations with fn, incrementing the revision in the same transaction if fn changed them.
+func (bs *BoltSource) update(fn func(confs *bolt.Bucket) (bool, error)) (int64, error) {
+	var rev int64
+	changed := false
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(boltMetaBucket)
+		rev = boltRevision(meta)
+		var err error
+		if changed, err = fn(tx.Bucket(boltConfsBucket)); err != nil || !changed {
+			return err
+		}
+		rev++
+		return meta.Put(boltRevisionKey, binary.BigEndian.AppendUint64(nil, uint64(rev)))
+	})
+	if err != nil {
+		return 0, err
+	}
+	if changed {
+		bs.notifier.notify(rev)
+	}
+	return rev, nil
+}
@@ -0,0 +1,239 @@
+//Package loader builds dlrouter routers from a directory of configuration files and rebuilds them when the
+//files change.
+//
+//Every YAML or JSON file of the directory holds one LocationConf, whose target is resolved by a TargetFunc.
+//A rebuilt router is published to the subscribers only if the files are read and compiled without any error,
+//so a broken file never replaces a working router.
+//
+//The configurations may also come from a ConfigSource, a store whose changes are numbered by revisions,
+//like MemorySource and the on-disk BoltSource.
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/conndots/dlrouter"
+)
+
+const (
+	DefaultDebounce = 200 * time.Millisecond
+)
+
+var (
+	DefaultPatterns = []string{"*.yaml", "*.yml", "*.json"}
+
+	NoConfErr = errors.New("[dlrouter loader] no configuration file")
+)
+
+//TargetFunc resolves the target of the LocationConf of a file from the name of the file and its target field,
+//nil if the file has none.
+type TargetFunc func(filename string, target interface{}) (interface{}, error)
+
+//FileTarget is the default TargetFunc: the target field of the file, or its base name without extension.
+func FileTarget(filename string, target interface{}) (interface{}, error) {
+	if target != nil {
+		return target, nil
+	}
+	base := filepath.Base(filename)
+	return strings.TrimSuffix(base, filepath.Ext(base)), nil
+}
+
+//Update is a router published by a Loader, with the files or the revision of the ConfigSource it was built from.
+type Update struct {
+	Router   *dlrouter.DomainLocationRouter
+	Files    []string
+	Revision int64
+	Time     time.Time
+}
+
+type Option func(*Loader)
+
+//WithPatterns sets the glob patterns of the configuration files in the directory, DefaultPatterns by default.
+func WithPatterns(patterns ...string) Option {
+	return func(l *Loader) {
+		l.patterns = patterns
+	}
+}
+
+//WithTargetFunc sets how the targets of the files are resolved, FileTarget by default.
+func WithTargetFunc(fn TargetFunc) Option {
+	return func(l *Loader) {
+		l.resolve = fn
+	}
+}
+
+//WithRouterOptions sets the options the routers are built with.
+func WithRouterOptions(opts ...dlrouter.RouterOption) Option {
+	return func(l *Loader) {
+		l.routerOpts = opts
+	}
+}
+
+//WithDebounce sets how long Watch waits for the changes to stop before rebuilding, DefaultDebounce by default.
+func WithDebounce(d time.Duration) Option {
+	return func(l *Loader) {
+		l.debounce = d
+	}
+}
+
+//WithPolling makes Watch poll the files every interval instead of being notified by the file system.
+func WithPolling(interval time.Duration) Option {
+	return func(l *Loader) {
+		l.poll = interval
+	}
+}
+
+//Loader loads the configuration files of a directory into a router.
+type Loader struct {
+	dir        string
+	patterns   []string
+	resolve    TargetFunc
+	routerOpts []dlrouter.RouterOption
+	debounce   time.Duration
+	poll       time.Duration //0 to be notified by the file system
+
+	mu          sync.Mutex
+	current     *Update
+	subscribers []func(*Update)
+	errHandlers []func([]error)
+}
+
+func New(dir string, opts ...Option) *Loader {
+	l := &Loader{
+		dir:      dir,
+		patterns: DefaultPatterns,
+		resolve:  FileTarget,
+		debounce: DefaultDebounce,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+//Subscribe calls fn with every router published from now on.
+func (l *Loader) Subscribe(fn func(*Update)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.subscribers = append(l.subscribers, fn)
+}
+
+//OnError calls fn with the errors of every load which is not published from now on.
+func (l *Loader) OnError(fn func([]error)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errHandlers = append(l.errHandlers, fn)
+}
+
+//Current returns the last published router, or nil.
+func (l *Loader) Current() *Update {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.current
+}
+
+//Files returns the configuration files of the directory, sorted.
+func (l *Loader) Files() ([]string, error) {
+	files := make([]string, 0, 8)
+	for _, pattern := range l.patterns {
+		matches, err := filepath.Glob(filepath.Join(l.dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			if !slices.Contains(files, match) {
+				files = append(files, match)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+//ReadConfs reads the LocationConfs of the configuration files in the order of Files.
+func (l *Loader) ReadConfs() ([]*dlrouter.LocationConf, []string, error) {
+	files, err := l.Files()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("%w in %s", NoConfErr, l.dir)
+	}
+	confs := make([]*dlrouter.LocationConf, 0, len(files))
+	for _, filename := range files {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		conf, err := dlrouter.ParseLocationConf(filename, data)
+		if err != nil {
+			return nil, nil, err
+		}
+		if conf.Target, err = l.resolve(filename, conf.Target); err != nil {
+			return nil, nil, fmt.Errorf("[dlrouter loader] target of %s: %w", filename, err)
+		}
+		confs = append(confs, conf)
+	}
+	return confs, files, nil
+}
+
+//Load reads and compiles the configuration files, and publishes the router if there is no error.
+//Otherwise the errors are passed to the error handlers, and returned.
+func (l *Loader) Load() (*Update, []error) {
+	confs, files, err := l.ReadConfs()
+	if err != nil {
+		return nil, l.fail([]error{err})
+	}
+	return l.build(confs, &Update{Files: files})
+}
+
+//build compiles confs into the router of update, and publishes it if there is no error.
+func (l *Loader) build(confs []*dlrouter.LocationConf, update *Update) (*Update, []error) {
+	router, errs := dlrouter.NewRouter(confs, l.routerOpts...)
+	if len(errs) > 0 {
+		return nil, l.fail(errs)
+	}
+
+	update.Router = router
+	update.Time = time.Now()
+	l.mu.Lock()
+	l.current = update
+	subscribers := l.subscribers
+	l.mu.Unlock()
+	for _, fn := range subscribers {
+		fn(update)
+	}
+	return update, nil
+}
+
+func (l *Loader) fail(errs []error) []error {
+	l.mu.Lock()
+	handlers := l.errHandlers
+	l.mu.Unlock()
+	for _, fn := range handlers {
+		fn(errs)
+	}
+	return errs
+}
+
+//matches tells whether filename is a configuration file of the directory by its name.
+func (l *Loader) matches(filename string) bool {
+	if filepath.Clean(filepath.Dir(filename)) != filepath.Clean(l.dir) {
+		return false
+	}
+	for _, pattern := range l.patterns {
+		if matched, _ := filepath.Match(pattern, filepath.Base(filename)); matched {
+			return true
+		}
+	}
+	return false
+}
+
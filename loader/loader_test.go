@@ -0,0 +1,147 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	shopConf = `
+mapping_conf:
+  - domains: [shop.com]
+    locations: [/cart/]
+`
+	searchConf = `{"target": "search-v2", "mapping_conf": [{"domains": ["shop.com"], "locations": ["/search/"]}]}`
+)
+
+func writeFile(t *testing.T, dir, name, data string) {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "shop.yaml", shopConf)
+	writeFile(t, dir, "search.json", searchConf)
+	writeFile(t, dir, "README.md", "not a configuration")
+
+	l := New(dir)
+	published := 0
+	l.Subscribe(func(*Update) { published++ })
+	update, errs := l.Load()
+	if len(errs) > 0 {
+		t.Fatalf("Load errors: %v", errs)
+	}
+	if len(update.Files) != 2 || published != 1 || l.Current() != update {
+		t.Errorf("update of 2 files expected; got: %v, published %d times", update.Files, published)
+	}
+	requests := map[string]interface{}{"/cart/1": "shop", "/search/q": "search-v2"}
+	for path, expected := range requests {
+		if target, found := update.Router.GetTarget("shop.com", path); !found || target.Value != expected {
+			t.Errorf("target of %s expected: %v; got: %v", path, expected, target)
+		}
+	}
+
+	writeFile(t, dir, "broken.yaml", "mapping_conf: [")
+	var handled []error
+	l.OnError(func(errs []error) { handled = errs })
+	if _, errs := l.Load(); len(errs) != 1 || len(handled) != 1 {
+		t.Errorf("parse error expected; got: %v", errs)
+	}
+	writeFile(t, dir, "broken.yaml", "mapping_conf: [{domains: [shop.com], locations: ['~ (']}]")
+	if _, errs := l.Load(); len(errs) != 1 {
+		t.Errorf("compile error expected; got: %v", errs)
+	}
+	if published != 1 || l.Current() != update {
+		t.Errorf("broken configurations must not be published")
+	}
+
+	l = New(t.TempDir())
+	if _, errs := l.Load(); len(errs) != 1 || !errors.Is(errs[0], NoConfErr) {
+		t.Errorf("error expected: %v; got: %v", NoConfErr, errs)
+	}
+}
+
+func TestTargetFunc(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "shop.yaml", shopConf)
+	backends := map[string]int{"shop": 8080}
+	l := New(dir, WithTargetFunc(func(filename string, target interface{}) (interface{}, error) {
+		name, _ := FileTarget(filename, target)
+		port, present := backends[name.(string)]
+		if !present {
+			return nil, errors.New("unknown backend")
+		}
+		return port, nil
+	}))
+	update, errs := l.Load()
+	if len(errs) > 0 {
+		t.Fatalf("Load errors: %v", errs)
+	}
+	if target, _ := update.Router.GetTarget("shop.com", "/cart/"); target == nil || target.Value != 8080 {
+		t.Errorf("target expected: 8080; got: %v", target)
+	}
+
+	writeFile(t, dir, "unknown.yaml", shopConf)
+	if _, errs := l.Load(); len(errs) != 1 {
+		t.Errorf("target error expected; got: %v", errs)
+	}
+}
+
+func testWatch(t *testing.T, opts ...Option) {
+	dir := t.TempDir()
+	writeFile(t, dir, "shop.yaml", shopConf)
+
+	l := New(dir, append(opts, WithDebounce(20*time.Millisecond))...)
+	updates := make(chan *Update, 4)
+	l.Subscribe(func(u *Update) { updates <- u })
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- l.Watch(ctx) }()
+
+	next := func() *Update {
+		select {
+		case u := <-updates:
+			return u
+		case <-time.After(5 * time.Second):
+			t.Fatal("no update published")
+			return nil
+		}
+	}
+	if u := next(); len(u.Files) != 1 {
+		t.Errorf("initial update of 1 file expected; got: %v", u.Files)
+	}
+
+	writeFile(t, dir, "broken.yaml", "mapping_conf: [")
+	for i := 0; i < 5; i++ {
+		writeFile(t, dir, "search.json", searchConf)
+	}
+	os.Remove(filepath.Join(dir, "broken.yaml"))
+	u := next()
+	if target, _ := u.Router.GetTarget("shop.com", "/search/"); target == nil || target.Value != "search-v2" {
+		t.Errorf("target of the new file expected: search-v2; got: %v", target)
+	}
+	select {
+	case u := <-updates:
+		t.Errorf("burst of changes expected to publish once; got another update of %v", u.Files)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Watch error: %v", err)
+	}
+}
+
+func TestWatchNotify(t *testing.T) {
+	testWatch(t)
+}
+
+func TestWatchPolling(t *testing.T) {
+	testWatch(t, WithPolling(5*time.Millisecond))
+}
@@ -0,0 +1,70 @@
+package loader
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/conndots/dlrouter"
+)
+
+//MemorySource is an in-process ConfigSource, a local stand-in for a remote store.
+type MemorySource struct {
+	mu       sync.RWMutex
+	confs    map[string]*dlrouter.LocationConf
+	notifier *revisionNotifier
+}
+
+func NewMemorySource() *MemorySource {
+	return &MemorySource{
+		confs:    make(map[string]*dlrouter.LocationConf, 8),
+		notifier: newRevisionNotifier(0),
+	}
+}
+
+func (ms *MemorySource) List(ctx context.Context) ([]*dlrouter.LocationConf, int64, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	keys := make([]string, 0, len(ms.confs))
+	for key := range ms.confs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	confs := make([]*dlrouter.LocationConf, 0, len(keys))
+	for _, key := range keys {
+		confs = append(confs, ms.confs[key])
+	}
+	rev, _ := ms.notifier.revision()
+	return confs, rev, nil
+}
+
+func (ms *MemorySource) Watch(ctx context.Context, rev int64) <-chan int64 {
+	return ms.notifier.watch(ctx, rev)
+}
+
+//Put stores conf by key, and returns the new revision.
+func (ms *MemorySource) Put(key string, conf *dlrouter.LocationConf) int64 {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.confs[key] = conf
+	return ms.bump()
+}
+
+//Delete removes the configuration of key, and returns the new revision.
+//The revision is unchanged if there is no configuration of key.
+func (ms *MemorySource) Delete(key string) int64 {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, present := ms.confs[key]; !present {
+		rev, _ := ms.notifier.revision()
+		return rev
+	}
+	delete(ms.confs, key)
+	return ms.bump()
+}
+
+func (ms *MemorySource) bump() int64 {
+	rev, _ := ms.notifier.revision()
+	ms.notifier.notify(rev + 1)
+	return rev + 1
+}
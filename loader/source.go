@@ -0,0 +1,95 @@
+package loader
+
+import (
+	"context"
+	"sync"
+
+	"github.com/conndots/dlrouter"
+)
+
+//ConfigSource is a store of LocationConfs by key. Every change of the store increments its revision.
+//Remote stores like etcd or Consul implement it to feed a Loader.
+type ConfigSource interface {
+	//List returns the configurations ordered by key, and the revision they are at.
+	List(ctx context.Context) ([]*dlrouter.LocationConf, int64, error)
+	//Watch returns a channel receiving the revision of the store whenever it is newer than rev.
+	//A slow receiver only gets the latest revision. The channel is closed when ctx is done.
+	Watch(ctx context.Context, rev int64) <-chan int64
+}
+
+//revisionNotifier keeps the revision of an in-process store and wakes up its watchers.
+type revisionNotifier struct {
+	mu      sync.Mutex
+	rev     int64
+	changed chan struct{} //closed and replaced on every change
+}
+
+func newRevisionNotifier(rev int64) *revisionNotifier {
+	return &revisionNotifier{rev: rev, changed: make(chan struct{})}
+}
+
+func (n *revisionNotifier) revision() (int64, <-chan struct{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.rev, n.changed
+}
+
+func (n *revisionNotifier) notify(rev int64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.rev = rev
+	close(n.changed)
+	n.changed = make(chan struct{})
+}
+
+func (n *revisionNotifier) watch(ctx context.Context, rev int64) <-chan int64 {
+	revs := make(chan int64, 1)
+	go func() {
+		defer close(revs)
+		for {
+			current, changed := n.revision()
+			if current > rev {
+				rev = current
+				select { //replace a revision not received yet
+				case <-revs:
+				default:
+				}
+				revs <- rev
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+			}
+		}
+	}()
+	return revs
+}
+
+//LoadSource lists and compiles the configurations of src, and publishes the router as Load does.
+func (l *Loader) LoadSource(ctx context.Context, src ConfigSource) (*Update, []error) {
+	_, update, errs := l.loadSource(ctx, src)
+	return update, errs
+}
+
+func (l *Loader) loadSource(ctx context.Context, src ConfigSource) (int64, *Update, []error) {
+	confs, rev, err := src.List(ctx)
+	if err != nil {
+		return 0, nil, l.fail([]error{err})
+	}
+	update, errs := l.build(confs, &Update{Revision: rev})
+	return rev, update, errs
+}
+
+//Follow loads the configurations of src, then reloads them at every new revision until ctx is done.
+//The revisions are debounced as the changes of Watch are.
+func (l *Loader) Follow(ctx context.Context, src ConfigSource) error {
+	rev, _, _ := l.loadSource(ctx, src)
+	changes := make(chan struct{}, 1)
+	go func() {
+		for range src.Watch(ctx, rev) {
+			signal(changes)
+		}
+	}()
+	return l.debounced(ctx, changes, nil, func() { l.LoadSource(ctx, src) })
+}
@@ -0,0 +1,147 @@
+package loader
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/conndots/dlrouter"
+)
+
+type testSource interface {
+	ConfigSource
+	put(key string, conf *dlrouter.LocationConf) int64
+	delete(key string) int64
+}
+
+type memoryTestSource struct{ *MemorySource }
+
+func (s memoryTestSource) put(key string, conf *dlrouter.LocationConf) int64 { return s.Put(key, conf) }
+func (s memoryTestSource) delete(key string) int64                           { return s.Delete(key) }
+
+type boltTestSource struct {
+	*BoltSource
+	t *testing.T
+}
+
+func (s boltTestSource) put(key string, conf *dlrouter.LocationConf) int64 {
+	rev, err := s.Put(key, conf)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return rev
+}
+
+func (s boltTestSource) delete(key string) int64 {
+	rev, err := s.Delete(key)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return rev
+}
+
+func getSourceConf(target string, locations ...string) *dlrouter.LocationConf {
+	return &dlrouter.LocationConf{
+		Target:      target,
+		MappingConf: []*dlrouter.MappingBlock{{Domains: []string{"shop.com"}, Locations: locations}},
+	}
+}
+
+func testConfigSource(t *testing.T, src testSource) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if rev := src.put("b", getSourceConf("search", "/search/")); rev != 1 {
+		t.Errorf("revision expected: 1; got: %d", rev)
+	}
+	revs := src.Watch(ctx, 1)
+	src.put("a", getSourceConf("cart", "/cart/"))
+	if rev := src.delete("missing"); rev != 2 {
+		t.Errorf("revision of a missing delete expected: 2; got: %d", rev)
+	}
+	select {
+	case rev := <-revs:
+		if rev != 2 {
+			t.Errorf("watched revision expected: 2; got: %d", rev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no revision watched")
+	}
+
+	confs, rev, err := src.List(ctx)
+	if err != nil || rev != 2 || len(confs) != 2 || confs[0].Target != "cart" || confs[1].Target != "search" {
+		t.Errorf("confs [cart search] at revision 2 expected; got: %v %d %v", confs, rev, err)
+	}
+
+	src.delete("b")
+	src.put("a", getSourceConf("cart", "/cart/", "/basket/"))
+	if rev := <-src.Watch(ctx, 0); rev != 4 {
+		t.Errorf("latest revision expected: 4; got: %d", rev)
+	}
+	cancel()
+	for range revs {
+	}
+}
+
+func TestMemorySource(t *testing.T) {
+	testConfigSource(t, memoryTestSource{NewMemorySource()})
+}
+
+func TestBoltSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.db")
+	src, err := OpenBoltSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testConfigSource(t, boltTestSource{src, t})
+	src.Close()
+
+	src, err = OpenBoltSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	confs, rev, err := src.List(context.Background())
+	if err != nil || rev != 4 || len(confs) != 1 || len(confs[0].MappingConf[0].Locations) != 2 {
+		t.Errorf("reopened source expected at revision 4; got: %v %d %v", confs, rev, err)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	src := NewMemorySource()
+	src.Put("cart", getSourceConf("cart", "/cart/"))
+
+	l := New("", WithDebounce(10*time.Millisecond))
+	updates := make(chan *Update, 4)
+	l.Subscribe(func(u *Update) { updates <- u })
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- l.Follow(ctx, src) }()
+
+	next := func() *Update {
+		select {
+		case u := <-updates:
+			return u
+		case <-time.After(5 * time.Second):
+			t.Fatal("no update published")
+			return nil
+		}
+	}
+	if u := next(); u.Revision != 1 {
+		t.Errorf("initial revision expected: 1; got: %d", u.Revision)
+	}
+
+	src.Put("broken", getSourceConf("broken", "~ ("))
+	src.Put("search", getSourceConf("search", "/search/"))
+	src.Delete("broken")
+	u := next()
+	if target, _ := u.Router.GetTarget("shop.com", "/search/"); u.Revision != 4 || target == nil || target.Value != "search" {
+		t.Errorf("target search at revision 4 expected; got: %v at %d", target, u.Revision)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Follow error: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package loader
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+//Watch loads the configuration files, then reloads them whenever they change, until ctx is done.
+//The changes are debounced: a burst of writes reloads once, after no change for the debounce duration.
+//Watch returns nil when ctx is done, or the error of the file system notifications.
+func (l *Loader) Watch(ctx context.Context) error {
+	changes := make(chan struct{}, 1)
+	errc := make(chan error, 1)
+	if l.poll > 0 {
+		go l.pollFiles(ctx, l.stamps(), changes)
+	} else {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return err
+		}
+		defer watcher.Close()
+		if err := watcher.Add(l.dir); err != nil {
+			return err
+		}
+		go l.notify(ctx, watcher, changes, errc)
+	}
+
+	l.Load()
+	return l.debounced(ctx, changes, errc, func() { l.Load() })
+}
+
+//debounced calls load after every burst of changes, until ctx is done or an error is received.
+func (l *Loader) debounced(ctx context.Context, changes <-chan struct{}, errc <-chan error, load func()) error {
+	timer := time.NewTimer(l.debounce)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errc:
+			return err
+		case <-changes:
+			timer.Stop()
+			select { //drain a timer which fired while being stopped
+			case <-timer.C:
+			default:
+			}
+			timer.Reset(l.debounce)
+		case <-timer.C:
+			load()
+		}
+	}
+}
+
+func signal(changes chan<- struct{}) {
+	select {
+	case changes <- struct{}{}:
+	default:
+	}
+}
+
+func (l *Loader) notify(ctx context.Context, watcher *fsnotify.Watcher, changes chan<- struct{}, errc chan<- error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !event.Has(fsnotify.Chmod) && l.matches(event.Name) {
+				signal(changes)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			errc <- err
+			return
+		}
+	}
+}
+
+//fileStamp identifies a version of a file by its size and modification time.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+func (l *Loader) stamps() map[string]fileStamp {
+	files, _ := l.Files()
+	stamps := make(map[string]fileStamp, len(files))
+	for _, filename := range files {
+		if info, err := os.Stat(filename); err == nil {
+			stamps[filename] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+		}
+	}
+	return stamps
+}
+
+func (l *Loader) pollFiles(ctx context.Context, last map[string]fileStamp, changes chan<- struct{}) {
+	ticker := time.NewTicker(l.poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stamps := l.stamps()
+			if !sameStamps(last, stamps) {
+				signal(changes)
+			}
+			last = stamps
+		}
+	}
+}
+
+func sameStamps(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for filename, stamp := range a {
+		if other, present := b[filename]; !present || !other.modTime.Equal(stamp.modTime) || other.size != stamp.size {
+			return false
+		}
+	}
+	return true
+}
@@ -1,5 +1,14 @@
 package dlrouter
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
 type pathConfType string
 
 const (
@@ -8,20 +17,166 @@ const (
 	pathConfTypeEqual  = "="
 )
 
+//LocationConf is the configuration of the locations of a target.
+//It is encoded with the keys target, mapping_conf and priority. Before it had tags, MappingConf was encoded
+//as mappingconf in YAML and MappingConf in JSON: both keys are still decoded, and unknown keys are rejected.
 type LocationConf struct {
-	Target      interface{}
-	MappingConf []*MappingBlock
+	Target      interface{}     `yaml:"target" json:"target"`
+	MappingConf []*MappingBlock `yaml:"mapping_conf" json:"mapping_conf"`
+	//Priority orders the target among the targets of the same location, the highest first
+	Priority int `yaml:"priority,omitempty" json:"priority,omitempty"`
 }
 
 type MappingBlock struct {
 	Domains   []string `yaml:"domains" json:"domains"`
 	Locations []string `yaml:"locations,omitempty" json:"locations,omitempty"`
+	//Names names some of the locations as routes to build URLs with: route name -> location
+	Names map[string]string `yaml:"names,omitempty" json:"names,omitempty"`
+	//Rewrites are the rewrite rules of the locations, applied by Resolve in order
+	Rewrites []*RewriteConf `yaml:"rewrites,omitempty" json:"rewrites,omitempty"`
+	//DefaultServer adds the locations to the default server of DefaultPorts, or of every port if empty,
+	//which serves the requests no router of their domain has a location for
+	DefaultServer bool  `yaml:"default_server,omitempty" json:"default_server,omitempty"`
+	DefaultPorts  []int `yaml:"default_ports,omitempty" json:"default_ports,omitempty"`
+	//Priority overrides the priority of the LocationConf for the locations of the block if not 0
+	Priority int `yaml:"priority,omitempty" json:"priority,omitempty"`
+
+	Pos         SourcePos   `yaml:"-" json:"-"` //position of the block
+	LocationPos []SourcePos `yaml:"-" json:"-"` //positions of Locations, if known
 }
 
 type DomainConf struct {
 	Domain    string
 	Locations []string
 	Target    interface{}
+	Rewrites  []*RewriteConf
+	Priority  int
+
+	Pos         SourcePos
+	LocationPos []SourcePos
+}
+
+//locationPos returns the position of the i-th location, or the position of the block if it is unknown.
+func (dc *DomainConf) locationPos(i int) SourcePos {
+	if i < len(dc.LocationPos) {
+		return dc.LocationPos[i]
+	}
+	return dc.Pos
+}
+
+//UnmarshalYAML records the lines of the block and its locations when decoded with gopkg.in/yaml.v3.
+func (mb *MappingBlock) UnmarshalYAML(value *yaml.Node) error {
+	type plain MappingBlock
+	if err := value.Decode((*plain)(mb)); err != nil {
+		return err
+	}
+	mb.Pos = SourcePos{Line: value.Line}
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		if value.Content[i].Value != "locations" {
+			continue
+		}
+		mb.LocationPos = make([]SourcePos, 0, len(value.Content[i+1].Content))
+		for _, location := range value.Content[i+1].Content {
+			mb.LocationPos = append(mb.LocationPos, SourcePos{Line: location.Line})
+		}
+	}
+	return nil
+}
+
+//locationConfKeys is LocationConf with the keys of MappingConf before it had tags.
+type locationConfKeys struct {
+	Target         interface{}     `yaml:"target" json:"target"`
+	MappingConf    []*MappingBlock `yaml:"mapping_conf" json:"mapping_conf"`
+	OldMappingConf []*MappingBlock `yaml:"mappingconf" json:"MappingConf"`
+	Priority       int             `yaml:"priority" json:"priority"`
+}
+
+func (keys *locationConfKeys) locationConf(lc *LocationConf) error {
+	if keys.MappingConf != nil && keys.OldMappingConf != nil {
+		return fmt.Errorf("[dlrouter conf] both mapping_conf and mappingconf are set")
+	}
+	if keys.MappingConf == nil {
+		keys.MappingConf = keys.OldMappingConf
+	}
+	*lc = LocationConf{Target: keys.Target, MappingConf: keys.MappingConf, Priority: keys.Priority}
+	return nil
+}
+
+//UnmarshalYAML decodes a LocationConf with either key of MappingConf, rejecting unknown keys.
+//Keys are matched case-insensitively, as in JSON, which is also decoded as YAML by ParseLocationConf.
+func (lc *LocationConf) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.MappingNode {
+		lowered := *value
+		lowered.Content = make([]*yaml.Node, len(value.Content))
+		copy(lowered.Content, value.Content)
+		for i := 0; i+1 < len(lowered.Content); i += 2 {
+			key := *lowered.Content[i]
+			key.Value = strings.ToLower(key.Value)
+			switch key.Value {
+			case "target", "mapping_conf", "mappingconf", "priority":
+			default:
+				return fmt.Errorf("[dlrouter conf] line %d: unknown key %q", key.Line, lowered.Content[i].Value)
+			}
+			lowered.Content[i] = &key
+		}
+		value = &lowered
+	}
+	var keys locationConfKeys
+	if err := value.Decode(&keys); err != nil {
+		return err
+	}
+	return keys.locationConf(lc)
+}
+
+//UnmarshalJSON decodes a LocationConf with either key of MappingConf, rejecting unknown keys.
+func (lc *LocationConf) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var keys locationConfKeys
+	if err := decoder.Decode(&keys); err != nil {
+		return err
+	}
+	return keys.locationConf(lc)
+}
+
+//ParseMappingBlocks decodes a YAML (or JSON) list of MappingBlocks, recording the positions of the blocks
+//and their locations in filename so that compile errors can point at them.
+func ParseMappingBlocks(filename string, data []byte) ([]*MappingBlock, error) {
+	var blocks []*MappingBlock
+	if err := yaml.Unmarshal(data, &blocks); err != nil {
+		return nil, fmt.Errorf("[dlrouter conf] parse %s: %v", filename, err)
+	}
+	for _, block := range blocks {
+		block.setFile(filename)
+	}
+	return blocks, nil
+}
+
+func (mb *MappingBlock) setFile(filename string) {
+	mb.Pos.File = filename
+	for i := range mb.LocationPos {
+		mb.LocationPos[i].File = filename
+	}
+}
+
+//ParseLocationConf decodes a YAML (or JSON) LocationConf, recording the positions of its blocks and their
+//locations in filename as ParseMappingBlocks does.
+func ParseLocationConf(filename string, data []byte) (*LocationConf, error) {
+	conf := &LocationConf{}
+	if err := yaml.Unmarshal(data, conf); err != nil {
+		return nil, fmt.Errorf("[dlrouter conf] parse %s: %v", filename, err)
+	}
+	for _, block := range conf.MappingConf {
+		block.setFile(filename)
+	}
+	return conf, nil
+}
+
+func (mb *MappingBlock) priority(confPriority int) int {
+	if mb.Priority != 0 {
+		return mb.Priority
+	}
+	return confPriority
 }
 
 func GetDomainConfs(conf *LocationConf) ([]*DomainConf, error) {
@@ -30,9 +185,13 @@ func GetDomainConfs(conf *LocationConf) ([]*DomainConf, error) {
 	for _, block := range blocks {
 		for _, domain := range block.Domains {
 			confs = append(confs, &DomainConf{
-				Domain:    domain,
-				Locations: block.Locations,
-				Target:    conf.Target,
+				Domain:      domain,
+				Locations:   block.Locations,
+				Target:      conf.Target,
+				Rewrites:    block.Rewrites,
+				Priority:    block.priority(conf.Priority),
+				Pos:         block.Pos,
+				LocationPos: block.LocationPos,
 			})
 		}
 	}
@@ -0,0 +1,184 @@
+package dlrouter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	//UnmatchedDomainLabel is the domain label of the misses of domains without any DomainRouter
+	UnmatchedDomainLabel = "_unmatched"
+
+	missResult = len(matchKindNames) //the index of the latency histogram of misses
+)
+
+var (
+	//DefaultLatencyBuckets are the upper bounds in seconds of the lookup latency histogram buckets
+	DefaultLatencyBuckets = []float64{1e-6, 2.5e-6, 5e-6, 1e-5, 2.5e-5, 5e-5, 1e-4, 2.5e-4, 5e-4, 1e-3, 1e-2}
+)
+
+type routeKey struct {
+	router  *DomainRouter
+	pattern string
+}
+
+type histogram struct {
+	counts []atomic.Uint64 //per bucket, the last one for +Inf
+	sumNs  atomic.Uint64
+}
+
+func (h *histogram) observe(buckets []float64, elapsed time.Duration) {
+	seconds := elapsed.Seconds()
+	i := sort.SearchFloat64s(buckets, seconds)
+	h.counts[i].Add(1)
+	h.sumNs.Add(uint64(elapsed))
+}
+
+//RouterMetrics instruments the lookups of a router: hits per configured domain, location and match kind,
+//misses per configured domain and lookup latency histograms per match kind. The labels are bounded to the
+//routes configured when it is created. It serves the metrics in the Prometheus text format.
+type RouterMetrics struct {
+	router  *DomainLocationRouter
+	buckets []float64
+
+	routes          []routeKey //sorted for the exposition
+	hits            map[routeKey]*atomic.Uint64
+	domains         []*DomainRouter
+	misses          map[*DomainRouter]*atomic.Uint64
+	unmatchedMisses atomic.Uint64
+	latency         [missResult + 1]histogram
+}
+
+//NewRouterMetrics instruments router. A nil buckets uses DefaultLatencyBuckets.
+func NewRouterMetrics(router *DomainLocationRouter, buckets []float64) *RouterMetrics {
+	if buckets == nil {
+		buckets = DefaultLatencyBuckets
+	}
+	rm := &RouterMetrics{
+		router:  router,
+		buckets: buckets,
+		routes:  make([]routeKey, 0, 16),
+		hits:    make(map[routeKey]*atomic.Uint64, 16),
+		domains: append(router.sortedDomainRouters(), router.DefaultServers()...),
+		misses:  make(map[*DomainRouter]*atomic.Uint64, len(router.DomainExactSearch)),
+	}
+	for i := range rm.latency {
+		rm.latency[i].counts = make([]atomic.Uint64, len(buckets)+1)
+	}
+
+	for _, dm := range rm.domains {
+		rm.misses[dm] = new(atomic.Uint64)
+		for _, pattern := range dm.locationPatterns() {
+			key := routeKey{router: dm, pattern: pattern}
+			rm.routes = append(rm.routes, key)
+			rm.hits[key] = new(atomic.Uint64)
+		}
+	}
+	return rm
+}
+
+//locationPatterns returns the patterns of the exact, prefix and regex locations, each kind sorted.
+func (dm *DomainRouter) locationPatterns() []string {
+	patterns := make([]string, 0, len(dm.LocationExactSearch)+dm.LocationPrefixSearch.Size+len(dm.regexOrder))
+	for location := range dm.LocationExactSearch {
+		patterns = append(patterns, exactPattern(location))
+	}
+	sort.Strings(patterns)
+	dm.LocationPrefixSearch.Walk(func(pattern string, _ []interface{}) bool {
+		patterns = append(patterns, pattern)
+		return true
+	})
+	regexStart := len(patterns)
+	for _, regexTar := range dm.regexOrder {
+		patterns = append(patterns, regexPattern(regexTar.RegexExp.String()))
+	}
+	sort.Strings(patterns[regexStart:])
+	return patterns
+}
+
+//GetTarget is the instrumented GetTarget of the router.
+func (rm *RouterMetrics) GetTarget(domain string, path string) (*Target, bool) {
+	start := time.Now()
+	dm, target, found := rm.router.Lookup(domain, path)
+	elapsed := time.Since(start)
+
+	if !found {
+		rm.latency[missResult].observe(rm.buckets, elapsed)
+		var first *DomainRouter
+		host, _ := splitHostPort(domain)
+		rm.router.eachDomainRouter(host, func(dm *DomainRouter, _ DomainStage) bool {
+			first = dm
+			return false
+		})
+		if counter, present := rm.misses[first]; present {
+			counter.Add(1)
+		} else {
+			rm.unmatchedMisses.Add(1)
+		}
+		return nil, false
+	}
+
+	rm.latency[target.Kind()].observe(rm.buckets, elapsed)
+	if counter, present := rm.hits[routeKey{router: dm, pattern: target.Pattern}]; present {
+		counter.Add(1)
+	}
+	return target, true
+}
+
+//WriteMetrics writes the metrics in the Prometheus text exposition format.
+func (rm *RouterMetrics) WriteMetrics(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	bw.WriteString("# HELP dlrouter_route_hits_total Lookups answered by a configured location.\n")
+	bw.WriteString("# TYPE dlrouter_route_hits_total counter\n")
+	for _, key := range rm.routes {
+		fmt.Fprintf(bw, "dlrouter_route_hits_total{domain=\"%s\",location=\"%s\",kind=\"%s\"} %d\n",
+			promEscape(key.router.Domain), promEscape(key.pattern), patternKind(key.pattern), rm.hits[key].Load())
+	}
+
+	bw.WriteString("# HELP dlrouter_route_misses_total Lookups without a target, by the first configured domain matching.\n")
+	bw.WriteString("# TYPE dlrouter_route_misses_total counter\n")
+	for _, dm := range rm.domains {
+		fmt.Fprintf(bw, "dlrouter_route_misses_total{domain=\"%s\"} %d\n", promEscape(dm.Domain), rm.misses[dm].Load())
+	}
+	fmt.Fprintf(bw, "dlrouter_route_misses_total{domain=\"%s\"} %d\n", UnmatchedDomainLabel, rm.unmatchedMisses.Load())
+
+	bw.WriteString("# HELP dlrouter_lookup_duration_seconds Latency of the lookups by the kind of the location matched.\n")
+	bw.WriteString("# TYPE dlrouter_lookup_duration_seconds histogram\n")
+	for i := range rm.latency {
+		result := "miss"
+		if i < missResult {
+			result = MatchKind(i).String()
+		}
+		h := &rm.latency[i]
+		cumulative := uint64(0)
+		for j := range h.counts {
+			cumulative += h.counts[j].Load()
+			le := "+Inf"
+			if j < len(rm.buckets) {
+				le = strconv.FormatFloat(rm.buckets[j], 'g', -1, 64)
+			}
+			fmt.Fprintf(bw, "dlrouter_lookup_duration_seconds_bucket{result=\"%s\",le=\"%s\"} %d\n", result, le, cumulative)
+		}
+		fmt.Fprintf(bw, "dlrouter_lookup_duration_seconds_sum{result=\"%s\"} %s\n", result,
+			strconv.FormatFloat(time.Duration(h.sumNs.Load()).Seconds(), 'g', -1, 64))
+		fmt.Fprintf(bw, "dlrouter_lookup_duration_seconds_count{result=\"%s\"} %d\n", result, cumulative)
+	}
+	return bw.Flush()
+}
+
+func (rm *RouterMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	rm.WriteMetrics(w)
+}
+
+func promEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
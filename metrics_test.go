@@ -0,0 +1,46 @@
+package dlrouter
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouterMetrics(t *testing.T) {
+	rm := NewRouterMetrics(getMappingManager(), []float64{1e-3, 1})
+
+	for i := 0; i < 3; i++ {
+		rm.GetTarget("products.byted.org", "/api/account/info")
+	}
+	rm.GetTarget("products.byted.org", "/page/video/sdfsdfweruFHUIER/1")
+	rm.GetTarget("api.neihan.com", "/api/neihan/video/detail/123435345")
+	target, exist := rm.GetTarget("products.byted.org", "/info/4/group/12345/comments/")
+	if !exist || target.Value != 1 || target.Variables["group_id"] != "12345" {
+		t.Errorf("instrumented get target error: %v", target)
+	}
+	rm.GetTarget("products.byted.org", "/page/postit/sdfsdfweruFHUIER/1")
+	rm.GetTarget("unknown.example.com", "/")
+
+	recorder := httptest.NewRecorder()
+	rm.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := recorder.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("content type error: %s", ct)
+	}
+	body := recorder.Body.String()
+	for _, expected := range []string{
+		`dlrouter_route_hits_total{domain="products.byted.org",location="= /api/account/info",kind="exact"} 3`,
+		`dlrouter_route_hits_total{domain="products.byted.org",location="/page/video/",kind="prefix"} 1`,
+		`dlrouter_route_hits_total{domain="products.byted.org",location="/info/:version/group/:group_id/",kind="prefix"} 1`,
+		`dlrouter_route_hits_total{domain="api.neihan.com",location="~ /api/neihan/video/detail/[0-9]+",kind="regex"} 1`,
+		`dlrouter_route_hits_total{domain="products.byted.org",location="/admin",kind="prefix"} 0`,
+		`dlrouter_route_misses_total{domain="products.byted.org"} 1`,
+		`dlrouter_route_misses_total{domain="_unmatched"} 1`,
+		`dlrouter_lookup_duration_seconds_bucket{result="exact",le="+Inf"} 3`,
+		`dlrouter_lookup_duration_seconds_count{result="prefix"} 2`,
+		`dlrouter_lookup_duration_seconds_count{result="miss"} 2`,
+	} {
+		if !strings.Contains(body, expected+"\n") {
+			t.Errorf("metrics miss %s", expected)
+		}
+	}
+}
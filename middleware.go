@@ -0,0 +1,28 @@
+package dlrouter
+
+import (
+	"context"
+	"net/http"
+)
+
+type targetContextKey struct{}
+
+//Middleware resolves the target of every request by its Host and URL path with GetTargetContext,
+//and passes it to next in the request context, see TargetFromContext. The domains are searched with the host
+//of the Host, its port only selects the default server.
+//Requests without a target are passed on without one.
+func (m *DomainLocationRouter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target, found := m.GetTargetContext(r.Context(), r.Host, r.URL.Path)
+		if found {
+			r = r.WithContext(context.WithValue(r.Context(), targetContextKey{}, target))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+//TargetFromContext returns the target Middleware resolved for the request of ctx.
+func TargetFromContext(ctx context.Context) (*Target, bool) {
+	target, found := ctx.Value(targetContextKey{}).(*Target)
+	return target, found
+}
@@ -0,0 +1,67 @@
+package dlrouter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type recordingTracer struct {
+	results []*LookupResult
+}
+
+func (rt *recordingTracer) StartLookup(ctx context.Context, domain, path string) func(*LookupResult) {
+	return func(result *LookupResult) {
+		rt.results = append(rt.results, result)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	sm := getMappingManager()
+	tracer := &recordingTracer{}
+	sm.Tracer = tracer
+
+	var target *Target
+	var found bool
+	handler := sm.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target, found = TargetFromContext(r.Context())
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://10.3.23.40:9009/wenda/web/feed/brow/", nil))
+	if !found || target.Value != 2 || target.Kind() != MatchExact {
+		t.Errorf("middleware target error: %v %v", found, target)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://products.byted.org/page/postit/", nil))
+	if found {
+		t.Errorf("middleware target expected none; got: %v", target)
+	}
+
+	if len(tracer.results) != 2 || tracer.results[0].Router.Domain != "10.3.23.40" || tracer.results[1].Target != nil {
+		t.Errorf("traced lookups error: %v", tracer.results)
+	}
+}
+
+func TestMiddlewareHostPort(t *testing.T) {
+	router := getDefaultServerRouter(t)
+
+	var target *Target
+	handler := router.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target, _ = TargetFromContext(r.Context())
+	}))
+	requests := []struct {
+		url    string
+		target interface{}
+	}{
+		{"http://www.shop.com:8443/x", "wildcard"},
+		{"http://shop.com:8443/cart/1", "shop"},
+		{"http://unknown.com:8080/", "admin"},
+	}
+	for _, req := range requests {
+		target = nil
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", req.url, nil))
+		if target == nil || target.Value != req.target {
+			t.Errorf("middleware target of %s expected: %v; got: %v", req.url, req.target, target)
+		}
+	}
+}
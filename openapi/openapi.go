@@ -0,0 +1,302 @@
+//Package openapi converts the paths of OpenAPI 3 documents to dlrouter location configurations.
+//
+//The router has no method dimension: the operations of a path on a host share a location, so they become a single
+//target, the Operations of the location by method, with a LocationConf per host and location.
+//Paths without templates become "=" locations. Templated paths like /users/{id} become prefix locations
+//with path variables (/users/:id), which also match the paths below them unless a longer location does.
+//Templates which are only part of a path segment, like /files/{name}.json, can not be path variables:
+//those paths become anchored regex locations, whose variables are not extracted.
+package openapi
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/conndots/dlrouter"
+	"gopkg.in/yaml.v3"
+)
+
+//methods in the order the operations of a path are converted in
+var methods = [...]string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+var templateRegex = regexp.MustCompile(`\{[^{}/]*\}`)
+
+//Operation is an operation of the Operations of a location.
+type Operation struct {
+	Host        string //host of the location
+	OperationID string //"METHOD path" for operations without operationId
+	Method      string //upper case
+}
+
+func (op Operation) String() string {
+	return op.Host + "#" + op.OperationID
+}
+
+//Operations is the target of a location: the operations of a path of a host, by method.
+type Operations struct {
+	Host    string
+	Path    string               //the path of the location, with the base path of the server
+	Methods map[string]Operation //by upper case method
+}
+
+func (ops *Operations) String() string {
+	return ops.Host + ops.Path
+}
+
+//Operation returns the operation of a request method.
+func (ops *Operations) Operation(method string) (Operation, bool) {
+	op, present := ops.Methods[strings.ToUpper(method)]
+	return op, present
+}
+
+//Warning reports an operation, or a part of it, which is not converted faithfully.
+type Warning struct {
+	Pos     dlrouter.SourcePos
+	Path    string
+	Message string
+}
+
+func (w *Warning) String() string {
+	return fmt.Sprintf("%s: path %s: %s", w.Pos, w.Path, w.Message)
+}
+
+type document struct {
+	OpenAPI string              `yaml:"openapi"`
+	Servers []server            `yaml:"servers"`
+	Paths   map[string]pathItem `yaml:"paths"`
+}
+
+type server struct {
+	URL       string `yaml:"url"`
+	Variables map[string]struct {
+		Default string `yaml:"default"`
+	} `yaml:"variables"`
+}
+
+type pathItem struct {
+	Servers []server `yaml:"servers"`
+	Get     *operation
+	Put     *operation
+	Post    *operation
+	Delete  *operation
+	Options *operation
+	Head    *operation
+	Patch   *operation
+	Trace   *operation
+}
+
+func (item *pathItem) operation(method string) *operation {
+	switch method {
+	case "get":
+		return item.Get
+	case "put":
+		return item.Put
+	case "post":
+		return item.Post
+	case "delete":
+		return item.Delete
+	case "options":
+		return item.Options
+	case "head":
+		return item.Head
+	case "patch":
+		return item.Patch
+	case "trace":
+		return item.Trace
+	}
+	return nil
+}
+
+type operation struct {
+	OperationID string   `yaml:"operationId"`
+	Servers     []server `yaml:"servers"`
+}
+
+//Importer converts OpenAPI documents, decoded from YAML or JSON.
+type Importer struct {
+	DefaultHost string //host of the servers with relative URLs, which are skipped if empty
+
+	confs    []*dlrouter.LocationConf
+	targets  map[string]*Operations //by host and location
+	warnings []*Warning
+}
+
+//LoadFiles converts the OpenAPI documents of the files with an Importer without default host.
+func LoadFiles(filenames ...string) ([]*dlrouter.LocationConf, []*Warning, error) {
+	im := &Importer{}
+	for _, filename := range filenames {
+		if err := im.LoadFile(filename); err != nil {
+			return nil, nil, err
+		}
+	}
+	return im.Confs(), im.Warnings(), nil
+}
+
+func (im *Importer) LoadFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return im.Parse(filename, data)
+}
+
+//Confs returns the configurations of the operations converted so far, in the order of the paths and methods
+//their locations are first converted for.
+func (im *Importer) Confs() []*dlrouter.LocationConf {
+	return im.confs
+}
+
+func (im *Importer) Warnings() []*Warning {
+	return im.warnings
+}
+
+//Parse converts the operations of an OpenAPI 3 document.
+func (im *Importer) Parse(filename string, data []byte) error {
+	var doc document
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("[dlrouter openapi] parse %s: %v", filename, err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return fmt.Errorf("[dlrouter openapi] parse %s: openapi version %q is not supported", filename, doc.OpenAPI)
+	}
+
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		item := doc.Paths[path]
+		warn := func(format string, args ...interface{}) {
+			im.warnings = append(im.warnings, &Warning{
+				Pos:     dlrouter.SourcePos{File: filename},
+				Path:    path,
+				Message: fmt.Sprintf(format, args...),
+			})
+		}
+
+		for _, method := range methods {
+			op := item.operation(method)
+			if op == nil {
+				continue
+			}
+			servers := op.Servers
+			if len(servers) == 0 {
+				servers = item.Servers
+			}
+			if len(servers) == 0 {
+				servers = doc.Servers
+			}
+			if len(servers) == 0 {
+				servers = []server{{URL: "/"}}
+			}
+
+			id := op.OperationID
+			if len(id) == 0 {
+				id = strings.ToUpper(method) + " " + path
+				warn("%s operation without operationId", strings.ToUpper(method))
+			}
+
+			for _, s := range servers {
+				host, basePath, err := im.parseServer(&s)
+				if err != nil {
+					warn("server %s: %v", s.URL, err)
+					continue
+				}
+				location, faithful := getLocation(basePath + path)
+				if !faithful {
+					warn("templates within path segments are converted to a regex without variables")
+				}
+				op := Operation{Host: host, OperationID: id, Method: strings.ToUpper(method)}
+				if shadowing, shadowed := im.addOperation(filename, basePath+path, location, op); shadowed {
+					warn("%s operation %s is shadowed by %s on host %s", op.Method, op.OperationID, shadowing.OperationID, host)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+//addOperation adds op to the target of its host and location, creating its configuration if there is none.
+//If the target has an operation of the method already, op is not added and that operation is returned.
+func (im *Importer) addOperation(filename, path, location string, op Operation) (Operation, bool) {
+	key := op.Host + " " + location
+	target, present := im.targets[key]
+	if !present {
+		target = &Operations{Host: op.Host, Path: path, Methods: make(map[string]Operation, 2)}
+		if im.targets == nil {
+			im.targets = make(map[string]*Operations, 8)
+		}
+		im.targets[key] = target
+		im.confs = append(im.confs, &dlrouter.LocationConf{
+			Target: target,
+			MappingConf: []*dlrouter.MappingBlock{{
+				Domains:   []string{op.Host},
+				Locations: []string{location},
+				Pos:       dlrouter.SourcePos{File: filename},
+			}},
+		})
+	}
+	if shadowing, present := target.Methods[op.Method]; present {
+		return shadowing, true
+	}
+	target.Methods[op.Method] = op
+	return Operation{}, false
+}
+
+//parseServer returns the host and the base path of a server, with its variables set to their defaults.
+func (im *Importer) parseServer(s *server) (string, string, error) {
+	rawURL := templateRegex.ReplaceAllStringFunc(s.URL, func(template string) string {
+		return s.Variables[template[1:len(template)-1]].Default
+	})
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", err
+	}
+	host := u.Hostname()
+	if len(host) == 0 {
+		if len(im.DefaultHost) == 0 {
+			return "", "", fmt.Errorf("relative server URL without default host")
+		}
+		host = im.DefaultHost
+	}
+	return host, strings.TrimSuffix(u.Path, "/"), nil
+}
+
+//getLocation converts an OpenAPI path to a location, reporting false if templates had to be converted to a regex.
+func getLocation(path string) (string, bool) {
+	if !strings.ContainsRune(path, '{') {
+		return "= " + path, true
+	}
+
+	segments := strings.Split(path, "/")
+	asVars := true
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") && strings.Count(segment, "{") == 1 {
+			segments[i] = ":" + segment[1:len(segment)-1]
+		} else if strings.ContainsAny(segment, "{:") {
+			asVars = false
+			break
+		}
+	}
+	if asVars {
+		return strings.Join(segments, "/"), true
+	}
+
+	var regex strings.Builder
+	regex.WriteString("~ ^")
+	last := 0
+	for _, loc := range templateRegex.FindAllStringIndex(path, -1) {
+		regex.WriteString(regexp.QuoteMeta(path[last:loc[0]]))
+		regex.WriteString("[^/]+")
+		last = loc[1]
+	}
+	regex.WriteString(regexp.QuoteMeta(path[last:]))
+	regex.WriteString("$")
+	return regex.String(), false
+}
@@ -0,0 +1,126 @@
+package openapi
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/conndots/dlrouter"
+)
+
+const spec = `openapi: 3.0.3
+info:
+  title: blog
+  version: "1"
+servers:
+- url: https://{env}.blog.example.com/v1/
+  variables:
+    env:
+      default: api
+paths:
+  /users:
+    get:
+      operationId: listUsers
+    post:
+      operationId: createUser
+  /users/{id}:
+    get:
+      operationId: getUser
+  /users/{id}/posts/{postId}:
+    get:
+      operationId: getPost
+  /files/{name}.json:
+    get: {}
+  /health:
+    servers:
+    - url: /
+    get:
+      operationId: health
+`
+
+func TestParse(t *testing.T) {
+	im := &Importer{DefaultHost: "internal.example.com"}
+	if err := im.Parse("blog.yaml", []byte(spec)); err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+
+	expected := []struct {
+		host, path string
+		location   string
+		methods    map[string]string
+	}{
+		{"api.blog.example.com", "/v1/files/{name}.json", `~ ^/v1/files/[^/]+\.json$`, map[string]string{"GET": "GET /files/{name}.json"}},
+		{"internal.example.com", "/health", "= /health", map[string]string{"GET": "health"}},
+		{"api.blog.example.com", "/v1/users", "= /v1/users", map[string]string{"GET": "listUsers", "POST": "createUser"}},
+		{"api.blog.example.com", "/v1/users/{id}", "/v1/users/:id", map[string]string{"GET": "getUser"}},
+		{"api.blog.example.com", "/v1/users/{id}/posts/{postId}", "/v1/users/:id/posts/:postId", map[string]string{"GET": "getPost"}},
+	}
+	confs := im.Confs()
+	if len(confs) != len(expected) {
+		t.Fatalf("conf number expected: %d; got: %d", len(expected), len(confs))
+	}
+	for i, conf := range confs {
+		target := conf.Target.(*Operations)
+		methods := make(map[string]string, len(target.Methods))
+		for method, op := range target.Methods {
+			methods[method] = op.OperationID
+		}
+		if target.Host != expected[i].host || target.Path != expected[i].path || !reflect.DeepEqual(methods, expected[i].methods) {
+			t.Errorf("target expected: %s%s %v; got: %v %v", expected[i].host, expected[i].path, expected[i].methods, target, methods)
+		}
+		domains := []string{expected[i].host}
+		if !reflect.DeepEqual(conf.MappingConf[0].Domains, domains) || conf.MappingConf[0].Locations[0] != expected[i].location {
+			t.Errorf("block of %v expected: %v %s; got: %v %v", conf.Target, domains, expected[i].location,
+				conf.MappingConf[0].Domains, conf.MappingConf[0].Locations)
+		}
+	}
+	if len(im.Warnings()) != 2 {
+		t.Errorf("warning number expected: 2; got: %v", im.Warnings())
+	}
+
+	router, errs := dlrouter.NewRouter(confs, dlrouter.WithConflictPolicy(dlrouter.ConflictError))
+	if len(errs) > 0 {
+		t.Fatalf("NewRouter errors: %v", errs)
+	}
+	target, found := router.GetTarget("api.blog.example.com", "/v1/users")
+	if !found {
+		t.Fatalf("target of /v1/users expected")
+	}
+	if op, _ := target.Value.(*Operations).Operation("post"); op.OperationID != "createUser" {
+		t.Errorf("POST operation expected: createUser; got: %v", op)
+	}
+	target, found = router.GetTarget("api.blog.example.com", "/v1/users/42/posts/7")
+	if !found {
+		t.Fatalf("target of /v1/users/42/posts/7 expected")
+	}
+	if op, _ := target.Value.(*Operations).Operation("GET"); op.OperationID != "getPost" {
+		t.Errorf("GET operation expected: getPost; got: %v", op)
+	}
+	if target.Variables["id"] != "42" || target.Variables["postId"] != "7" {
+		t.Errorf("variables expected: id=42 postId=7; got: %v", target.Variables)
+	}
+}
+
+func TestParseShadowed(t *testing.T) {
+	im := &Importer{}
+	for _, filename := range []string{"a.yaml", "b.yaml"} {
+		doc := "openapi: 3.0.3\nservers:\n- url: https://api.example.com\npaths:\n  /users:\n    get:\n      operationId: " +
+			filename[:1] + "Users\n"
+		if err := im.Parse(filename, []byte(doc)); err != nil {
+			t.Fatalf("Parse error: %v", err)
+		}
+	}
+	if len(im.Confs()) != 1 {
+		t.Errorf("conf number expected: 1; got: %d", len(im.Confs()))
+	}
+	expected := "b.yaml: path /users: GET operation bUsers is shadowed by aUsers on host api.example.com"
+	if len(im.Warnings()) != 1 || im.Warnings()[0].String() != expected {
+		t.Errorf("warnings expected: [%s]; got: %v", expected, im.Warnings())
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	im := &Importer{}
+	if err := im.Parse("swagger.yaml", []byte("swagger: \"2.0\"\n")); err == nil {
+		t.Errorf("error expected for swagger 2.0 documents")
+	}
+}
@@ -0,0 +1,91 @@
+package dlrouter
+
+type routerOptions struct {
+	strict   bool
+	policy   DomainPolicy
+	conflict ConflictPolicy
+}
+
+//DomainPolicy chooses the target of a lookup among the domain routers matching its domain.
+type DomainPolicy uint8
+
+const (
+	//DomainFirst returns the target of the first domain router, in the order of the exact, postfix and prefix
+	//domain search stages, which has a location matching the path.
+	DomainFirst DomainPolicy = iota
+	//BestLocation returns the best location matching the path of all the domain routers matching the domain:
+	//an exact location before the longest prefix location before a regex location. Ties go to the router
+	//found first.
+	BestLocation
+)
+
+var domainPolicyNames = [...]string{
+	DomainFirst:  "domain-first",
+	BestLocation: "best-location",
+}
+
+func (p DomainPolicy) String() string {
+	if int(p) < len(domainPolicyNames) {
+		return domainPolicyNames[p]
+	}
+	return "unknown"
+}
+
+//ConflictPolicy decides between the targets of a location configured for a domain more than once.
+type ConflictPolicy uint8
+
+const (
+	//PriorityWins orders the targets of a location by descending priority, then in configuration order.
+	PriorityWins ConflictPolicy = iota
+	//FirstWins orders the targets of a location in configuration order, ignoring their priorities.
+	FirstWins
+	//ConflictError orders the targets as PriorityWins, but a different target of the same priority as one
+	//already configured for the location is not added, and reported by a CompileError of CompileErrorConflict.
+	ConflictError
+)
+
+var conflictPolicyNames = [...]string{
+	PriorityWins:  "priority-wins",
+	FirstWins:     "first-wins",
+	ConflictError: "error",
+}
+
+func (p ConflictPolicy) String() string {
+	if int(p) < len(conflictPolicyNames) {
+		return conflictPolicyNames[p]
+	}
+	return "unknown"
+}
+
+//RouterOption configures how NewRouter builds a router.
+type RouterOption func(*routerOptions)
+
+//WithStrictCompile makes NewRouter fail on the first compile error, returning a nil router
+//instead of a router built from the valid part of the configurations.
+func WithStrictCompile() RouterOption {
+	return func(opts *routerOptions) {
+		opts.strict = true
+	}
+}
+
+//WithDomainPolicy sets how a target is chosen among the domain routers matching a domain, DomainFirst by default.
+func WithDomainPolicy(policy DomainPolicy) RouterOption {
+	return func(opts *routerOptions) {
+		opts.policy = policy
+	}
+}
+
+//WithConflictPolicy sets how the targets sharing a location are ordered, PriorityWins by default.
+func WithConflictPolicy(policy ConflictPolicy) RouterOption {
+	return func(opts *routerOptions) {
+		opts.conflict = policy
+	}
+}
+
+func getRouterOptions(opts []RouterOption) *routerOptions {
+	options := &routerOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
@@ -0,0 +1,93 @@
+//Package otelrouter traces the route resolutions of dlrouter with OpenTelemetry.
+package otelrouter
+
+import (
+	"context"
+
+	"github.com/conndots/dlrouter"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/conndots/dlrouter/otelrouter"
+
+	SpanName  = "dlrouter.lookup"
+	EventName = "dlrouter.lookup"
+
+	DomainKey          = attribute.Key("dlrouter.domain")
+	PathKey            = attribute.Key("dlrouter.path")
+	MatchedKey         = attribute.Key("dlrouter.matched")
+	DomainPatternKey   = attribute.Key("dlrouter.domain_pattern")
+	DomainStageKey     = attribute.Key("dlrouter.domain_stage")
+	LocationPatternKey = attribute.Key("dlrouter.location_pattern")
+	MatchTypeKey       = attribute.Key("dlrouter.match_type")
+	VariablePrefix     = "dlrouter.var." //prefix of the attributes of the path variables
+)
+
+//Tracer is a dlrouter.LookupTracer recording a span, or an event on the span of the context, per lookup.
+type Tracer struct {
+	tracer     trace.Tracer
+	spanEvents bool
+}
+
+type Option func(*Tracer)
+
+//WithSpanEvents records the lookups as events on the span of the lookup context instead of as spans.
+func WithSpanEvents() Option {
+	return func(t *Tracer) {
+		t.spanEvents = true
+	}
+}
+
+//NewTracer creates a Tracer with the tracers of tp, or of the global TracerProvider if tp is nil.
+func NewTracer(tp trace.TracerProvider, opts ...Option) *Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	t := &Tracer{tracer: tp.Tracer(instrumentationName)}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+func (t *Tracer) StartLookup(ctx context.Context, domain, path string) func(result *dlrouter.LookupResult) {
+	if t.spanEvents {
+		span := trace.SpanFromContext(ctx)
+		return func(result *dlrouter.LookupResult) {
+			span.AddEvent(EventName, trace.WithAttributes(resultAttributes(result)...))
+		}
+	}
+
+	_, span := t.tracer.Start(ctx, SpanName, trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(DomainKey.String(domain), PathKey.String(path)))
+	return func(result *dlrouter.LookupResult) {
+		span.SetAttributes(resultAttributes(result)[2:]...)
+		span.End()
+	}
+}
+
+//resultAttributes returns the attributes of a lookup, starting with the domain and the path looked up.
+func resultAttributes(result *dlrouter.LookupResult) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, 8)
+	attrs = append(attrs,
+		DomainKey.String(result.Domain),
+		PathKey.String(result.Path),
+		MatchedKey.Bool(result.Target != nil),
+	)
+	if result.Target == nil {
+		return attrs
+	}
+	attrs = append(attrs,
+		DomainPatternKey.String(result.Router.Domain),
+		DomainStageKey.String(result.Stage.String()),
+		LocationPatternKey.String(result.Target.Pattern),
+		MatchTypeKey.String(result.Target.Kind().String()),
+	)
+	for name, value := range result.Target.Variables {
+		attrs = append(attrs, attribute.String(VariablePrefix+name, value))
+	}
+	return attrs
+}
@@ -0,0 +1,83 @@
+package otelrouter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/conndots/dlrouter"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func getTracedRouter(t *testing.T, opts ...Option) (*dlrouter.DomainLocationRouter, *tracetest.InMemoryExporter, *sdktrace.TracerProvider) {
+	router, errs := dlrouter.NewRouter([]*dlrouter.LocationConf{{
+		Target: "aweme",
+		MappingConf: []*dlrouter.MappingBlock{{
+			Domains:   []string{"aweme.snssdk.com"},
+			Locations: []string{"/aweme/v1/:search_type/search/", "= /aweme/v1/feed/"},
+		}},
+	}})
+	if len(errs) > 0 {
+		t.Fatalf("new router errors: %v", errs)
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	router.Tracer = NewTracer(tp, opts...)
+	return router, exporter, tp
+}
+
+func attributeMap(attrs []attribute.KeyValue) map[attribute.Key]attribute.Value {
+	m := make(map[attribute.Key]attribute.Value, len(attrs))
+	for _, attr := range attrs {
+		m[attr.Key] = attr.Value
+	}
+	return m
+}
+
+func TestLookupSpans(t *testing.T) {
+	router, exporter, _ := getTracedRouter(t)
+
+	handler := router.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if target, found := dlrouter.TargetFromContext(r.Context()); !found || target.Value != "aweme" {
+			t.Errorf("target in context error: %v", target)
+		}
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://aweme.snssdk.com/aweme/v1/discover/search/", nil))
+	router.GetTargetContext(context.Background(), "aweme.snssdk.com", "/unknown")
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 || spans[0].Name != SpanName {
+		t.Fatalf("spans expected: 2 %s; got: %v", SpanName, spans)
+	}
+	attrs := attributeMap(spans[0].Attributes)
+	if attrs[DomainKey].AsString() != "aweme.snssdk.com" || !attrs[MatchedKey].AsBool() ||
+		attrs[DomainPatternKey].AsString() != "aweme.snssdk.com" || attrs[DomainStageKey].AsString() != "exact" ||
+		attrs[LocationPatternKey].AsString() != "/aweme/v1/:search_type/search/" ||
+		attrs[MatchTypeKey].AsString() != "prefix" || attrs[VariablePrefix+"search_type"].AsString() != "discover" {
+		t.Errorf("span attributes error: %v", spans[0].Attributes)
+	}
+	attrs = attributeMap(spans[1].Attributes)
+	if attrs[MatchedKey].AsBool() || attrs[PathKey].AsString() != "/unknown" {
+		t.Errorf("miss span attributes error: %v", spans[1].Attributes)
+	}
+}
+
+func TestLookupSpanEvents(t *testing.T) {
+	router, exporter, tp := getTracedRouter(t, WithSpanEvents())
+
+	ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+	router.GetTargetContext(ctx, "aweme.snssdk.com", "/aweme/v1/feed/")
+	span.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || len(spans[0].Events) != 1 || spans[0].Events[0].Name != EventName {
+		t.Fatalf("span events expected: 1 %s; got: %v", EventName, spans)
+	}
+	attrs := attributeMap(spans[0].Events[0].Attributes)
+	if attrs[MatchTypeKey].AsString() != "exact" || attrs[LocationPatternKey].AsString() != "= /aweme/v1/feed/" {
+		t.Errorf("span event attributes error: %v", spans[0].Events[0].Attributes)
+	}
+}
@@ -0,0 +1,209 @@
+package pathtree
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+var (
+	CorruptEncodingErr = errors.New("[pathtree decode] corrupt path tree encoding")
+)
+
+//AppendBinary appends the binary encoding of the tree structure to buf.
+//Leaf values are encoded as the ids returned by encodeValue, in their order and with their priorities.
+func (ct *PathTree) AppendBinary(buf []byte, encodeValue func(value interface{}) (uint64, error)) ([]byte, error) {
+	enc := &encoder{
+		encodeValue: encodeValue,
+		valIDs:      make(map[uint]uint64, 8),
+	}
+	return enc.node(buf, ct)
+}
+
+type encoder struct {
+	encodeValue func(value interface{}) (uint64, error)
+	valIDs      map[uint]uint64 //valID -> encoded valID, numbered in the order of appearance
+}
+
+func (enc *encoder) valID(buf []byte, id uint) []byte {
+	encoded, present := enc.valIDs[id]
+	if !present {
+		encoded = uint64(len(enc.valIDs))
+		enc.valIDs[id] = encoded
+	}
+	return binary.AppendUvarint(buf, encoded)
+}
+
+func (enc *encoder) node(buf []byte, ct *PathTree) ([]byte, error) {
+	buf = append(buf, byte(ct.nodeType))
+	buf = appendString(buf, ct.path)
+	buf = binary.AppendUvarint(buf, uint64(ct.Size))
+
+	buf = binary.AppendUvarint(buf, uint64(len(ct.LeafValues)))
+	for _, leaf := range ct.LeafValues {
+		id, err := enc.encodeValue(leaf.value)
+		if err != nil {
+			return nil, err
+		}
+		buf = enc.valID(buf, leaf.valID)
+		buf = binary.AppendUvarint(buf, id)
+		buf = appendString(buf, leaf.pattern)
+		buf = binary.AppendVarint(buf, int64(leaf.priority))
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(ct.pathVars)))
+	for _, pvar := range ct.pathVars {
+		buf = enc.valID(buf, pvar.valID)
+		buf = appendString(buf, pvar.variable)
+	}
+
+	keys := make([]int, 0, len(ct.childrenIdx))
+	for c := range ct.childrenIdx {
+		keys = append(keys, int(c))
+	}
+	sort.Ints(keys)
+	buf = binary.AppendUvarint(buf, uint64(len(keys)))
+	for _, c := range keys {
+		buf = append(buf, byte(c))
+		var err error
+		buf, err = enc.node(buf, ct.childrenIdx[byte(c)])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+//DecodeBinary decodes a tree encoded by AppendBinary from the start of data, resolving the leaf values
+//with decodeValue. It returns the tree and the bytes following its encoding.
+func DecodeBinary(data []byte, decodeValue func(id uint64) (interface{}, error)) (*PathTree, []byte, error) {
+	dec := &decoder{
+		data:        data,
+		decodeValue: decodeValue,
+		valIDs:      make(map[uint64]uint, 8),
+	}
+	tree := dec.node()
+	if dec.err != nil {
+		return nil, nil, dec.err
+	}
+	if tree.nodeType != NodeTypeRoot {
+		return nil, nil, CorruptEncodingErr
+	}
+	return tree, dec.data, nil
+}
+
+type decoder struct {
+	data        []byte
+	err         error
+	decodeValue func(id uint64) (interface{}, error)
+	valIDs      map[uint64]uint //encoded valID -> valID of this process
+}
+
+func (dec *decoder) node() *PathTree {
+	node := &PathTree{
+		nodeType: NodeType(dec.byte()),
+		path:     dec.string(),
+		Size:     int(dec.uvarint()),
+	}
+	if node.nodeType > NodeTypeVar {
+		dec.fail(CorruptEncodingErr)
+	}
+
+	leafNum := dec.length()
+	node.LeafValues = make([]*target, 0, leafNum)
+	for i := 0; i < leafNum && dec.err == nil; i++ {
+		id := dec.valID()
+		value, err := dec.decodeValue(dec.uvarint())
+		if err != nil {
+			dec.fail(err)
+			break
+		}
+		pattern := dec.string()
+		node.LeafValues = append(node.LeafValues, newTarget(value, id, pattern, int(dec.varint())))
+	}
+
+	varNum := dec.length()
+	for i := 0; i < varNum && dec.err == nil; i++ {
+		id := dec.valID()
+		node.pathVars = append(node.pathVars, getPathVarWithID(dec.string(), id))
+	}
+
+	childNum := dec.length()
+	node.childrenIdx = make(map[byte]*PathTree, childNum)
+	for i := 0; i < childNum && dec.err == nil; i++ {
+		c := dec.byte()
+		node.childrenIdx[c] = dec.node()
+	}
+	return node
+}
+
+func (dec *decoder) fail(err error) {
+	if dec.err == nil {
+		dec.err = err
+	}
+	dec.data = nil
+}
+
+func (dec *decoder) byte() byte {
+	if len(dec.data) == 0 {
+		dec.fail(CorruptEncodingErr)
+		return 0
+	}
+	b := dec.data[0]
+	dec.data = dec.data[1:]
+	return b
+}
+
+func (dec *decoder) uvarint() uint64 {
+	v, n := binary.Uvarint(dec.data)
+	if n <= 0 {
+		dec.fail(CorruptEncodingErr)
+		return 0
+	}
+	dec.data = dec.data[n:]
+	return v
+}
+
+func (dec *decoder) varint() int64 {
+	v, n := binary.Varint(dec.data)
+	if n <= 0 {
+		dec.fail(CorruptEncodingErr)
+		return 0
+	}
+	dec.data = dec.data[n:]
+	return v
+}
+
+//length reads an element count, which can never exceed the remaining bytes
+func (dec *decoder) length() int {
+	n := dec.uvarint()
+	if n > uint64(len(dec.data)) {
+		dec.fail(CorruptEncodingErr)
+		return 0
+	}
+	return int(n)
+}
+
+func (dec *decoder) string() string {
+	n := dec.length()
+	s := string(dec.data[:n])
+	dec.data = dec.data[n:]
+	return s
+}
+
+//valID maps an encoded valID to a fresh one, keeping the leaves and the path variables of a pattern linked.
+func (dec *decoder) valID() uint {
+	encoded := dec.uvarint()
+	id, present := dec.valIDs[encoded]
+	if !present {
+		valID++
+		id = valID
+		dec.valIDs[encoded] = id
+	}
+	return id
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
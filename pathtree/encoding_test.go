@@ -0,0 +1,44 @@
+package pathtree
+
+import (
+	"testing"
+)
+
+func TestEncodingRoundTrip(t *testing.T) {
+	tree := getPathTreeWithVar(NewPathTree())
+	values := make([]interface{}, 0, 16)
+	encodeValue := func(value interface{}) (uint64, error) {
+		values = append(values, value)
+		return uint64(len(values) - 1), nil
+	}
+	data, err := tree.AppendBinary([]byte("head"), encodeValue)
+	if err != nil || string(data[:4]) != "head" {
+		t.Fatalf("append binary error: %v", err)
+	}
+
+	decoded, rest, err := DecodeBinary(append(data[4:], "tail"...), func(id uint64) (interface{}, error) {
+		return values[id], nil
+	})
+	if err != nil || string(rest) != "tail" {
+		t.Fatalf("decode binary error: %v, rest: %q", err, rest)
+	}
+	if decoded.Size != tree.Size {
+		t.Errorf("size expected: %d; got: %d", tree.Size, decoded.Size)
+	}
+
+	cands := decoded.GetCandidateLeafs("/service/2/information/12345/detail")
+	if len(cands) != 1 || cands[0].Value != "app_info" || cands[0].Variables["version"] != "2" || cands[0].Variables["group_id"] != "12345" {
+		t.Errorf("/service/2/information/12345/detail get err: %v", cands)
+	}
+	decoded.Add("/service/:version/status", "app_status")
+	cands = decoded.GetCandidateLeafs("/service/3/status")
+	if len(cands) != 1 || cands[0].Value != "app_status" || cands[0].Variables["version"] != "3" {
+		t.Errorf("/service/3/status after decoding get err: %v", cands)
+	}
+
+	if _, _, err := DecodeBinary(data[4:len(data)-2], func(id uint64) (interface{}, error) {
+		return values[id], nil
+	}); err != CorruptEncodingErr {
+		t.Errorf("truncated encoding expected: %v; got: %v", CorruptEncodingErr, err)
+	}
+}
@@ -0,0 +1,62 @@
+package pathtree
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+var nodeTypeNames = [...]string{
+	NodeTypeRoot:    "root",
+	NodeTypeDefault: "default",
+	NodeTypeLeaf:    "leaf",
+	NodeTypeVar:     "var",
+}
+
+func (t NodeType) String() string {
+	if int(t) < len(nodeTypeNames) {
+		return nodeTypeNames[t]
+	}
+	return "unknown"
+}
+
+//NodeInfo is the exported structure of a PathTree node, children ordered by their first byte.
+type NodeInfo struct {
+	Path     string        `json:"path"`
+	NodeType string        `json:"node_type"`
+	Values   []interface{} `json:"values,omitempty"`
+	Vars     []string      `json:"vars,omitempty"`
+	Children []*NodeInfo   `json:"children,omitempty"`
+}
+
+//NodeInfo exports the structure of the tree. Leaf values are exported as returned by mapValue,
+//or as they are if mapValue is nil.
+func (ct *PathTree) NodeInfo(mapValue func(value interface{}) interface{}) *NodeInfo {
+	info := &NodeInfo{
+		Path:     ct.path,
+		NodeType: ct.nodeType.String(),
+	}
+	for _, leaf := range ct.LeafValues {
+		value := leaf.value
+		if mapValue != nil {
+			value = mapValue(value)
+		}
+		info.Values = append(info.Values, value)
+	}
+	for _, pvar := range ct.pathVars {
+		info.Vars = append(info.Vars, pvar.variable)
+	}
+
+	keys := make([]int, 0, len(ct.childrenIdx))
+	for c := range ct.childrenIdx {
+		keys = append(keys, int(c))
+	}
+	sort.Ints(keys)
+	for _, c := range keys {
+		info.Children = append(info.Children, ct.childrenIdx[byte(c)].NodeInfo(mapValue))
+	}
+	return info
+}
+
+func (ct *PathTree) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ct.NodeInfo(nil))
+}
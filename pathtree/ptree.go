@@ -2,7 +2,7 @@ package pathtree
 
 import (
 	"fmt"
-	"github.com/golang-collections/collections/queue"
+	"sort"
 	"strings"
 	"bytes"
 )
@@ -28,13 +28,18 @@ type pathVar struct {
 	variable string
 }
 type target struct {
-	valID    uint
-	value    interface{}
+	valID     uint
+	value     interface{}
+	pattern   string           //the pattern the value was added with
+	priority  int              //values of higher priority are matched first
+	candidate *TargetCandidate //shared candidate returned when the match binds no path variables
 }
 
 type TargetCandidate struct {
 	Value     interface{}
 	Variables map[string]string
+	Pattern   string //the pattern matched
+	Matched   int    //the length of the prefix of the target matched by the pattern
 }
 
 type PathTree struct {
@@ -70,6 +75,16 @@ func getPathVarWithID(pvar string, id uint) *pathVar {
 	}
 }
 
+func newTarget(value interface{}, id uint, pattern string, priority int) *target {
+	return &target{
+		valID:     id,
+		value:     value,
+		pattern:   pattern,
+		priority:  priority,
+		candidate: &TargetCandidate{Value: value, Pattern: pattern, Matched: len(pattern)},
+	}
+}
+
 func getPathEndingAtVar(path string) string {
 	pos := strings.IndexByte(path, varSymbol)
 	if pos >= 0 {
@@ -77,7 +92,27 @@ func getPathEndingAtVar(path string) string {
 	}
 	return path
 }
+
+//addLeaf inserts t into the values of the node after the values of higher or equal priority.
+func (ct *PathTree) addLeaf(t *target) {
+	pos := len(ct.LeafValues)
+	for pos > 0 && ct.LeafValues[pos-1].priority < t.priority {
+		pos--
+	}
+	ct.LeafValues = append(ct.LeafValues, nil)
+	copy(ct.LeafValues[pos+1:], ct.LeafValues[pos:])
+	ct.LeafValues[pos] = t
+}
+
+//Add adds value with the pattern str and priority 0.
 func (ct *PathTree) Add(str string, value interface{}) error {
+	return ct.AddWithPriority(str, value, 0)
+}
+
+//AddWithPriority adds value with the pattern str. The values of the patterns sharing a leaf, identical up to
+//the names of their variables, are matched by descending priority, then in the order they were added.
+func (ct *PathTree) AddWithPriority(str string, value interface{}, priority int) error {
+	pattern := str
 	valID++
 	ct.Size++
 
@@ -139,10 +174,7 @@ loopStart:
 					ct = sub
 					ct.pathVars = append(ct.pathVars, pvar)
 					if len(str) == 0 { //str已经添加完成
-						ct.LeafValues = append(ct.LeafValues, &target{
-							valID: valID,
-							value: value,
-						})
+						ct.addLeaf(newTarget(value, valID, pattern, priority))
 					}
 
 					if len(str) > 0 {
@@ -165,10 +197,7 @@ loopStart:
 				ct = child
 
 				if len(str) == 0 {
-					child.LeafValues = []*target{{
-						value:    value,
-						valID:    valID,
-					}}
+					child.LeafValues = []*target{newTarget(value, valID, pattern, priority)}
 					return nil
 				}
 			} else { //normal
@@ -197,52 +226,87 @@ loopStart:
 			}
 
 		} else if diffSt == len(str) {
-			ct.LeafValues = append(ct.LeafValues, &target{
-				value:    value,
-				valID:    valID,
-			})
+			ct.addLeaf(newTarget(value, valID, pattern, priority))
 			if ct.nodeType != NodeTypeRoot {
 				ct.nodeType = NodeTypeLeaf
 			}
 			return nil
 		}
 	}
-
-	return nil
 }
 
-func (ct *PathTree) getTargetCandidates(target string, pathVarsMap map[uint]map[string]string, candidates []*TargetCandidate) []*TargetCandidate {
-	var varValue string
-	end := strings.IndexByte(target, pathSplitter)
-	if end == -1 {
-		varValue = target
-	} else {
-		varValue = target[:end]
+//PatternValues returns the values of the leaf of pattern and their priorities, in matching order.
+//Patterns identical up to the names of their variables share a leaf.
+func (ct *PathTree) PatternValues(pattern string) ([]interface{}, []int) {
+	node := ct
+	for {
+		if node.nodeType == NodeTypeVar {
+			pos := strings.IndexByte(pattern, pathSplitter)
+			if pos < 0 {
+				pattern = ""
+			} else {
+				pattern = pattern[pos:]
+			}
+		} else {
+			if !strings.HasPrefix(pattern, node.path) {
+				return nil, nil
+			}
+			pattern = pattern[len(node.path):]
+		}
+		if len(pattern) == 0 {
+			break
+		}
+		next, present := node.childrenIdx[pattern[0]]
+		if !present {
+			return nil, nil
+		}
+		node = next
 	}
 
-	for _, pvar := range ct.pathVars {
-		pmap, exist := pathVarsMap[pvar.valID]
-		if !exist {
-			pmap = make(map[string]string, 2)
-			pathVarsMap[pvar.valID] = pmap
-		}
-		pmap[pvar.variable] = varValue
+	values := make([]interface{}, 0, len(node.LeafValues))
+	priorities := make([]int, 0, len(node.LeafValues))
+	for _, leaf := range node.LeafValues {
+		values = append(values, leaf.value)
+		priorities = append(priorities, leaf.priority)
 	}
+	return values, priorities
+}
 
-	for _, lval := range ct.LeafValues {
-		if ct.nodeType == NodeTypeVar {
-			pathVars := pathVarsMap[lval.valID]
-			candidates = append(candidates, &TargetCandidate{
-				Value:     lval.value,
-				Variables: pathVars,
-			})
+//getTargetCandidates appends the values of the node, whose path ends matched bytes into the target.
+func (ct *PathTree) getTargetCandidates(target string, matched int, pathVarsMap map[uint]map[string]string, candidates []*TargetCandidate) []*TargetCandidate {
+	if len(ct.pathVars) > 0 {
+		var varValue string
+		end := strings.IndexByte(target, pathSplitter)
+		if end == -1 {
+			varValue = target
 		} else {
-			pathVars := pathVarsMap[lval.valID]
-			candidates = append(candidates, &TargetCandidate{
-				Value:     lval.value,
-				Variables: pathVars,
-			})
+			varValue = target[:end]
+		}
+
+		for _, pvar := range ct.pathVars {
+			pmap, exist := pathVarsMap[pvar.valID]
+			if !exist {
+				pmap = make(map[string]string, 2)
+				pathVarsMap[pvar.valID] = pmap
+			}
+			pmap[pvar.variable] = varValue
+		}
+	}
+
+	//backwards, as the candidates are reversed at last
+	for i := len(ct.LeafValues) - 1; i >= 0; i-- {
+		lval := ct.LeafValues[i]
+		pathVars, hasVars := pathVarsMap[lval.valID]
+		if !hasVars {
+			candidates = append(candidates, lval.candidate)
+			continue
 		}
+		candidates = append(candidates, &TargetCandidate{
+			Value:     lval.value,
+			Variables: pathVars,
+			Pattern:   lval.pattern,
+			Matched:   matched,
+		})
 	}
 	return candidates
 }
@@ -252,44 +316,52 @@ type searchContext struct {
 	partialTarget string
 }
 
-func (ct *PathTree) GetCandidateLeafs(target string) (candidates []*TargetCandidate) {
+//GetCandidateLeafs returns the values of all the patterns matching target, the longest match first.
+func (ct *PathTree) GetCandidateLeafs(target string) []*TargetCandidate {
+	return ct.AppendCandidateLeafs(make([]*TargetCandidate, 0, 2), target)
+}
+
+//AppendCandidateLeafs appends the candidates of GetCandidateLeafs to candidates and returns the extended slice.
+//Matches without path variables share a candidate created when the value was added, so a lookup into a
+//caller provided buffer on a tree without variable nodes on the way performs no heap allocation.
+//The returned candidates must not be modified.
+func (ct *PathTree) AppendCandidateLeafs(candidates []*TargetCandidate, target string) []*TargetCandidate {
 	if len(target) == 0 {
-		return make([]*TargetCandidate, 0, 0)
+		return candidates
 	}
-	candidates = make([]*TargetCandidate, 0, 2)
-	defer func() {
-		//reverse it, because the longest match matters.
-		for st, end := 0, len(candidates)-1; st < end; st, end = st+1, end-1 {
-			candidates[st], candidates[end] = candidates[end], candidates[st]
-		}
-	}()
+	start := len(candidates)
 
 	/**
 	广度优先遍历
 	为何选择广度优先遍历？返回值默认按照最长匹配的顺序返回候选。广度优先遍历保证数组添加顺序是按照匹配长度递增的顺序
 	*/
-	//记录遇到的所有路径上所有的pathVars
-	pathVarsMap := make(map[uint]map[string]string, 2) //map[valID]map[varName]varValue
-	queue := queue.New()
-
-	queue.Enqueue(&searchContext{
+	//记录遇到的所有路径上所有的pathVars, 遇到第一个变量节点时才分配
+	var pathVarsMap map[uint]map[string]string //map[valID]map[varName]varValue
+	var queueBuf [16]searchContext
+	queue := append(queueBuf[:0], searchContext{
 		node:          ct,
 		partialTarget: target,
 	})
 
-	for queue.Len() > 0 {
-		ctx := queue.Dequeue().(*searchContext)
-		curr := ctx.node
-		tar := ctx.partialTarget
+	for head := 0; head < len(queue); head++ {
+		curr := queue[head].node
+		tar := queue[head].partialTarget
 
 		if curr.nodeType == NodeTypeVar {
-			candidates = curr.getTargetCandidates(tar, pathVarsMap, candidates)
+			if pathVarsMap == nil {
+				pathVarsMap = make(map[uint]map[string]string, 2)
+			}
 			pos := strings.IndexByte(tar, pathSplitter)
+			matched := len(target)
+			if pos >= 0 {
+				matched -= len(tar) - pos
+			}
+			candidates = curr.getTargetCandidates(tar, matched, pathVarsMap, candidates)
 			if pos >= 0 {
 				nextTar := tar[pos:]
 				nextCh, hasChild := curr.childrenIdx[pathSplitter]
 				if hasChild {
-					queue.Enqueue(&searchContext{
+					queue = append(queue, searchContext{
 						node:          nextCh,
 						partialTarget: nextTar,
 					})
@@ -302,33 +374,98 @@ func (ct *PathTree) GetCandidateLeafs(target string) (candidates []*TargetCandid
 			}
 			if i < plen { //path与target不匹配
 				continue
-			} else {
-				candidates = curr.getTargetCandidates(tar, pathVarsMap, candidates)
-
-				if i < tlen { // target还有未处理的
-					nextTar := tar[i:]
-					next, hasChild := curr.childrenIdx[nextTar[0]]
-					nextVar, hasVarChild := curr.childrenIdx[varSymbol]
-					if !hasChild && !hasVarChild {
-						continue
-					}
+			}
+			candidates = curr.getTargetCandidates(tar, len(target)-tlen+plen, pathVarsMap, candidates)
 
-					if hasVarChild {
-						queue.Enqueue(&searchContext{
-							node:          nextVar,
-							partialTarget: nextTar,
-						})
-					}
-					if hasChild {
-						queue.Enqueue(&searchContext{
-							node:          next,
-							partialTarget: nextTar,
-						})
-					}
+			if i < tlen { // target还有未处理的
+				nextTar := tar[i:]
+				next, hasChild := curr.childrenIdx[nextTar[0]]
+				nextVar, hasVarChild := curr.childrenIdx[varSymbol]
+
+				if hasVarChild {
+					queue = append(queue, searchContext{
+						node:          nextVar,
+						partialTarget: nextTar,
+					})
+				}
+				if hasChild {
+					queue = append(queue, searchContext{
+						node:          next,
+						partialTarget: nextTar,
+					})
 				}
 			}
 		}
 	}
+
+	//reverse it, because the longest match matters.
+	for st, end := start, len(candidates)-1; st < end; st, end = st+1, end-1 {
+		candidates[st], candidates[end] = candidates[end], candidates[st]
+	}
+	return candidates
+}
+
+type searchOffset struct {
+	node  *PathTree
+	start int //the offset of the part of the target the node is matched against
+}
+
+//AppendPrefixLeafs appends the candidates of the patterns matching target as AppendCandidateLeafs does,
+//without binding path variables: the candidates of patterns with variables have none.
+//target is not retained, so it may be a buffer of the caller, and the lookup performs no heap allocation
+//if candidates has the room for the matches.
+func (ct *PathTree) AppendPrefixLeafs(candidates []*TargetCandidate, target []byte) []*TargetCandidate {
+	if len(target) == 0 {
+		return candidates
+	}
+	start := len(candidates)
+
+	var queueBuf [16]searchOffset
+	queue := append(queueBuf[:0], searchOffset{node: ct})
+	for head := 0; head < len(queue); head++ {
+		curr := queue[head].node
+		tar := target[queue[head].start:]
+
+		if curr.nodeType == NodeTypeVar {
+			candidates = curr.appendSharedCandidates(candidates)
+			if pos := bytes.IndexByte(tar, pathSplitter); pos >= 0 {
+				if next, hasChild := curr.childrenIdx[pathSplitter]; hasChild {
+					queue = append(queue, searchOffset{node: next, start: queue[head].start + pos})
+				}
+			}
+			continue
+		}
+
+		i := 0
+		tlen, plen := len(tar), len(curr.path)
+		for ; i < tlen && i < plen && tar[i] == curr.path[i]; i++ {
+		}
+		if i < plen {
+			continue
+		}
+		candidates = curr.appendSharedCandidates(candidates)
+		if i < tlen {
+			nextStart := queue[head].start + i
+			if nextVar, hasVarChild := curr.childrenIdx[varSymbol]; hasVarChild {
+				queue = append(queue, searchOffset{node: nextVar, start: nextStart})
+			}
+			if next, hasChild := curr.childrenIdx[tar[i]]; hasChild {
+				queue = append(queue, searchOffset{node: next, start: nextStart})
+			}
+		}
+	}
+
+	for st, end := start, len(candidates)-1; st < end; st, end = st+1, end-1 {
+		candidates[st], candidates[end] = candidates[end], candidates[st]
+	}
+	return candidates
+}
+
+//appendSharedCandidates appends the shared candidates of the values of the node, backwards as getTargetCandidates does.
+func (ct *PathTree) appendSharedCandidates(candidates []*TargetCandidate) []*TargetCandidate {
+	for i := len(ct.LeafValues) - 1; i >= 0; i-- {
+		candidates = append(candidates, ct.LeafValues[i].candidate)
+	}
 	return candidates
 }
 
@@ -388,3 +525,64 @@ func (ct *PathTree) Print() {
 	fmt.Println(ct.String())
 	fmt.Println("\n-------------------------")
 }
+
+//Walk calls fn with every pattern added to the tree, including the names of its path variables, and the
+//values added with it, in sorted order of the patterns. Walking stops when fn returns false.
+func (ct *PathTree) Walk(fn func(pattern string, values []interface{}) bool) {
+	ct.WalkPriorities(func(pattern string, values []interface{}, _ []int) bool {
+		return fn(pattern, values)
+	})
+}
+
+//WalkPriorities is Walk also passing the priorities the values were added with. Unlike PatternValues, the values
+//and priorities are the ones of the pattern only, not of every pattern sharing its leaf.
+func (ct *PathTree) WalkPriorities(fn func(pattern string, values []interface{}, priorities []int) bool) {
+	patterns := make(map[string][]*target, ct.Size)
+	ancestors := make([]*PathTree, 0, 8)
+
+	var visit func(node *PathTree)
+	visit = func(node *PathTree) {
+		ancestors = append(ancestors, node)
+		for _, leaf := range node.LeafValues {
+			var buf bytes.Buffer
+			for _, n := range ancestors {
+				if n.nodeType != NodeTypeVar {
+					buf.WriteString(n.path)
+					continue
+				}
+				for _, pvar := range n.pathVars {
+					if pvar.valID == leaf.valID {
+						buf.WriteByte(varSymbol)
+						buf.WriteString(pvar.variable)
+						break
+					}
+				}
+			}
+			pattern := buf.String()
+			patterns[pattern] = append(patterns[pattern], leaf)
+		}
+		for _, child := range node.childrenIdx {
+			visit(child)
+		}
+		ancestors = ancestors[:len(ancestors)-1]
+	}
+	visit(ct)
+
+	sorted := make([]string, 0, len(patterns))
+	for pattern := range patterns {
+		sorted = append(sorted, pattern)
+	}
+	sort.Strings(sorted)
+	for _, pattern := range sorted {
+		leaves := patterns[pattern]
+		values := make([]interface{}, 0, len(leaves))
+		priorities := make([]int, 0, len(leaves))
+		for _, leaf := range leaves {
+			values = append(values, leaf.value)
+			priorities = append(priorities, leaf.priority)
+		}
+		if !fn(pattern, values, priorities) {
+			return
+		}
+	}
+}
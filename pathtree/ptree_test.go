@@ -2,6 +2,7 @@ package pathtree
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -210,9 +211,185 @@ func TestCTrieGetCandidates(t *testing.T) {
 	}
 }
 
+func TestCandidateMatched(t *testing.T) {
+	tree := NewPathTree()
+	tree.Add("/api/:identifier_of_the_user", "user")
+	tree.Add("/api/v1/users/", "users")
+	tree.Add("/api/:version/users/:id/posts", "posts")
+	matched := map[interface{}]int{}
+	for _, c := range tree.GetCandidateLeafs("/api/v1/users/5/posts/7") {
+		matched[c.Value] = c.Matched
+	}
+	expected := map[interface{}]int{"user": len("/api/v1"), "users": len("/api/v1/users/"), "posts": len("/api/v1/users/5/posts")}
+	if fmt.Sprint(matched) != fmt.Sprint(expected) {
+		t.Errorf("matched lengths expected: %v; got: %v", expected, matched)
+	}
+}
+
+func TestAppendCandidateLeafsAllocs(t *testing.T) {
+	trie := getPreparedCTrie()
+	var buf [8]*TargetCandidate
+	allocs := testing.AllocsPerRun(100, func() {
+		candidates := trie.AppendCandidateLeafs(buf[:0], "www.google.uk.wtf.fuck")
+		if len(candidates) != 4 || candidates[0].Value != 6 || candidates[3].Value != 2 {
+			t.Fatalf("www.google.uk.wtf.fuck expected: %v got: %v", []int{6, 5, 1, 2}, candidates)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("append candidates allocs expected: 0; got: %v", allocs)
+	}
+
+	tree := getPathTreeWithVar(NewPathTree())
+	candidates := tree.AppendCandidateLeafs(buf[:1], "/aw/v1/user/12345")
+	if len(candidates) != 2 || candidates[1].Value != "aw_user" || candidates[1].Variables["user_id"] != "12345" {
+		t.Errorf("/aw/v1/user/12345 append candidates error: %v", candidates)
+	}
+}
+
+func TestAppendPrefixLeafs(t *testing.T) {
+	tree := getPathTreeWithVar(getPreparedCTrie())
+	for _, path := range []string{"www.google.uk.wtf.fuck", "/aw/v1/user/12345", "/hot/item/video/play/1", "/i5/info/", "/unknown"} {
+		expected := make([]string, 0, 4)
+		for _, c := range tree.GetCandidateLeafs(path) {
+			expected = append(expected, fmt.Sprint(c.Value, " ", c.Pattern))
+		}
+		got := make([]string, 0, 4)
+		for _, c := range tree.AppendPrefixLeafs(nil, []byte(path)) {
+			got = append(got, fmt.Sprint(c.Value, " ", c.Pattern))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("prefix leafs of %s expected: %v; got: %v", path, expected, got)
+		}
+	}
+
+	var buf [8]*TargetCandidate
+	allocs := testing.AllocsPerRun(100, func() {
+		var target [32]byte
+		n := copy(target[:], "/aw/v1/user/12345")
+		if candidates := tree.AppendPrefixLeafs(buf[:0], target[:n]); len(candidates) != 1 || candidates[0].Value != "aw_user" {
+			t.Fatalf("/aw/v1/user/12345 expected: [aw_user]; got: %v", candidates)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("append prefix leafs allocs expected: 0; got: %v", allocs)
+	}
+}
+
 func BenchmarkCTrieGetCandidates(b *testing.B) {
 	trie := getPreparedCTrie()
+	b.ReportAllocs()
 	for n := 0; n < b.N; n++ {
 		trie.GetCandidateLeafs("www.google.uk.wtf.fuck.hello.what.the.fuck")
 	}
 }
+
+func TestNodeInfo(t *testing.T) {
+	tree := NewPathTree()
+	tree.Add("/item/:item_id", "item")
+	tree.Add("/info/", "info")
+
+	info := tree.NodeInfo(nil)
+	if info.NodeType != "root" || info.Path != "/i" || len(info.Children) != 2 {
+		t.Fatalf("root node info error: %v", info)
+	}
+	info = info.Children[1]
+	if info.Path != "tem/" || len(info.Children) != 1 || info.Children[0].NodeType != "var" ||
+		info.Children[0].Vars[0] != "item_id" || info.Children[0].Values[0] != "item" {
+		t.Errorf("/item/:item_id node info error: %v", info)
+	}
+
+	data, err := tree.MarshalJSON()
+	if err != nil || !strings.Contains(string(data), `{"path":"nfo/","node_type":"leaf","values":["info"]}`) {
+		t.Errorf("json error: %v %s", err, data)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	tree := getPathTreeWithVar(getPreparedCTrie())
+	tree.Add("/item/:item_id", "tt_item_dup")
+
+	patterns := make([]string, 0, 20)
+	values := make(map[string][]interface{}, 20)
+	tree.Walk(func(pattern string, vals []interface{}) bool {
+		patterns = append(patterns, pattern)
+		values[pattern] = vals
+		return true
+	})
+
+	expected := []string{
+		"/aw/v1/:search_type/search/", "/aw/v:version/feed/", "/aw/v:version/poi/feed/", "/aw/v:version/user/:user_id",
+		"/aweme/v1/aweme/post", "/group/:group_id", "/hot/item/:item_id/comments/", "/hot/item/video/play/",
+		"/i:item_id/info/", "/item/:item_id", "/service/:version/information/:group_id/", "/tt/pc/a:group_id",
+		"/tt/pc/a:item_id", "www.", "www.google", "www.google.hk.", "www.google.uk", "www.google.uk.wtf", "www.google.us.",
+	}
+	if len(patterns) != len(expected) {
+		t.Fatalf("walk patterns expected: %v; got: %v", expected, patterns)
+	}
+	for i, pattern := range expected {
+		if patterns[i] != pattern {
+			t.Errorf("walk pattern %d expected: %s; got: %s", i, pattern, patterns[i])
+		}
+	}
+	if v := values["/item/:item_id"]; len(v) != 2 || v[0] != "tt_item" || v[1] != "tt_item_dup" {
+		t.Errorf("/item/:item_id values error: %v", v)
+	}
+
+	walked := 0
+	tree.Walk(func(string, []interface{}) bool {
+		walked++
+		return walked < 3
+	})
+	if walked != 3 {
+		t.Errorf("walk expected to stop after 3 patterns, walked %d", walked)
+	}
+}
+
+func TestAddWithPriority(t *testing.T) {
+	trie := NewPathTree()
+	trie.Add("/a/", 1)
+	trie.AddWithPriority("/a/", 2, 5)
+	trie.AddWithPriority("/a/", 3, 5)
+	trie.AddWithPriority("/a/", 4, -1)
+
+	values, priorities := trie.PatternValues("/a/")
+	if fmt.Sprint(values) != "[2 3 1 4]" || fmt.Sprint(priorities) != "[5 5 0 -1]" {
+		t.Errorf("values of /a/ expected: [2 3 1 4] [5 5 0 -1]; got: %v %v", values, priorities)
+	}
+	cands := trie.GetCandidateLeafs("/a/b")
+	if len(cands) != 4 || cands[0].Value != 2 {
+		t.Errorf("first candidate of /a/b expected: 2; got: %v", cands)
+	}
+	if values, _ := trie.PatternValues("/b/"); values != nil {
+		t.Errorf("values of /b/ expected: nil; got: %v", values)
+	}
+}
+
+func TestWalkPriorities(t *testing.T) {
+	trie := NewPathTree()
+	trie.AddWithPriority("/u/:x", "A", 5)
+	trie.Add("/u/:y", "B")
+	walked := make([]string, 0, 2)
+	trie.WalkPriorities(func(pattern string, values []interface{}, priorities []int) bool {
+		walked = append(walked, fmt.Sprint(pattern, values, priorities))
+		return true
+	})
+	if fmt.Sprint(walked) != "[/u/:x[A] [5] /u/:y[B] [0]]" {
+		t.Errorf("walked patterns expected: [/u/:x[A] [5] /u/:y[B] [0]]; got: %v", walked)
+	}
+
+	data, err := trie.AppendBinary(nil, func(value interface{}) (uint64, error) {
+		return map[interface{}]uint64{"A": 0, "B": 1}[value], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _, err := DecodeBinary(data, func(id uint64) (interface{}, error) {
+		return []string{"A", "B"}[id], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values, priorities := decoded.PatternValues("/u/:x"); fmt.Sprint(values, priorities) != "[A B] [5 0]" {
+		t.Errorf("decoded values expected: [A B] [5 0]; got: %v %v", values, priorities)
+	}
+}
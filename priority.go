@@ -0,0 +1,74 @@
+package dlrouter
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ConflictErr = errors.New("[dlrouter compile] another target of the same priority has the location")
+)
+
+//priority returns the priority of the locations of dconf under the conflict policy of the router.
+func (dm *DomainRouter) priority(dconf *DomainConf) int {
+	if dm.conflict == FirstWins {
+		return 0
+	}
+	return dconf.Priority
+}
+
+//checkConflict returns ConflictErr under the ConflictError policy if a target other than target has
+//the priority among the targets of a location.
+func (dm *DomainRouter) checkConflict(targets []interface{}, priorities []int, target interface{}, priority int) error {
+	if dm.conflict != ConflictError {
+		return nil
+	}
+	for i, t := range targets {
+		if i < len(priorities) && priorities[i] == priority && !SameTarget(t, target) {
+			return fmt.Errorf("%w: %v and %v of priority %d", ConflictErr, t, target, priority)
+		}
+	}
+	return nil
+}
+
+//locationPriorities returns the priorities of the n targets of the exact or regex location pattern.
+func (dm *DomainRouter) locationPriorities(pattern string, n int) []int {
+	priorities := dm.priorities[pattern]
+	for len(priorities) < n {
+		priorities = append(priorities, 0)
+	}
+	return priorities
+}
+
+//insertPriority records a target of priority for the exact or regex location pattern with n targets,
+//and returns its position: after the targets of higher or equal priority.
+func (dm *DomainRouter) insertPriority(pattern string, n int, priority int) int {
+	priorities := dm.locationPriorities(pattern, n)
+	pos := len(priorities)
+	for pos > 0 && priorities[pos-1] < priority {
+		pos--
+	}
+	priorities = append(priorities, 0)
+	copy(priorities[pos+1:], priorities[pos:])
+	priorities[pos] = priority
+
+	if dm.priorities == nil {
+		dm.priorities = make(map[string][]int, 4)
+	}
+	dm.priorities[pattern] = priorities
+	return pos
+}
+
+func insertValue(values []interface{}, pos int, value interface{}) []interface{} {
+	values = append(values, nil)
+	copy(values[pos+1:], values[pos:])
+	values[pos] = value
+	return values
+}
+
+func insertTarget(targets []*Target, pos int, target *Target) []*Target {
+	targets = append(targets, nil)
+	copy(targets[pos+1:], targets[pos:])
+	targets[pos] = target
+	return targets
+}
@@ -0,0 +1,158 @@
+package dlrouter
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func getPriorityConfs() []*LocationConf {
+	return []*LocationConf{
+		{
+			Target: "low",
+			MappingConf: []*MappingBlock{
+				{Domains: []string{"a.com"}, Locations: []string{"= /x", "/p/", "~ ^/r"}},
+			},
+		},
+		{
+			Target:   "high",
+			Priority: 10,
+			MappingConf: []*MappingBlock{
+				{Domains: []string{"a.com"}, Locations: []string{"= /x", "/p/", "~ ^/r"}},
+				{Domains: []string{"a.com"}, Locations: []string{"/q/"}, Priority: -1},
+			},
+		},
+		{
+			Target: "other",
+			MappingConf: []*MappingBlock{
+				{Domains: []string{"a.com"}, Locations: []string{"/q/"}},
+			},
+		},
+	}
+}
+
+func TestPriority(t *testing.T) {
+	requests := []struct {
+		policy ConflictPolicy
+		path   string
+		target interface{}
+	}{
+		{PriorityWins, "/x", "high"},
+		{PriorityWins, "/p/1", "high"},
+		{PriorityWins, "/r", "high"},
+		{PriorityWins, "/q/1", "other"},
+		{FirstWins, "/x", "low"},
+		{FirstWins, "/p/1", "low"},
+		{FirstWins, "/r", "low"},
+		{FirstWins, "/q/1", "high"},
+	}
+	for _, req := range requests {
+		router, errs := NewRouter(getPriorityConfs(), WithConflictPolicy(req.policy))
+		if len(errs) > 0 {
+			t.Fatalf("NewRouter errors: %v", errs)
+		}
+		target, found := router.GetTarget("a.com", req.path)
+		if !found || target.Value != req.target {
+			t.Errorf("target of %s with %v expected: %v; got: %v", req.path, req.policy, req.target, target)
+		}
+	}
+}
+
+func TestConflictError(t *testing.T) {
+	confs := append(getPriorityConfs(), &LocationConf{
+		Target: "conflict",
+		MappingConf: []*MappingBlock{
+			{Domains: []string{"a.com"}, Locations: []string{"= /x", "/p/"}},
+			{Domains: []string{"a.com"}, Locations: []string{"~ ^/r"}, Priority: 10},
+		},
+	}, &LocationConf{
+		Target: "low",
+		MappingConf: []*MappingBlock{
+			{Domains: []string{"a.com"}, Locations: []string{"= /x"}},
+		},
+	})
+	router, errs := NewRouter(confs, WithConflictPolicy(ConflictError))
+	if len(errs) != 3 {
+		t.Fatalf("3 conflicts expected; got: %v", errs)
+	}
+	for _, err := range errs {
+		var compileErr *CompileError
+		if !errors.As(err, &compileErr) || compileErr.Kind != CompileErrorConflict || !errors.Is(err, ConflictErr) {
+			t.Errorf("conflict error expected; got: %v", err)
+		}
+	}
+	if targets, _ := router.GetAllTargets("a.com", "/x"); len(targets) != 2 {
+		t.Errorf("targets of /x expected: [high low]; got: %v", targets)
+	}
+}
+
+func TestPriorityExport(t *testing.T) {
+	router, errs := NewRouter(getPriorityConfs())
+	if len(errs) > 0 {
+		t.Fatalf("NewRouter errors: %v", errs)
+	}
+	expected, _ := json.Marshal(router)
+
+	confs := router.ExportConfs()
+	if len(confs) != 3 || confs[1].Target != "high" || len(confs[1].MappingConf) != 2 ||
+		confs[1].MappingConf[0].Priority != 10 || confs[1].MappingConf[1].Priority != -1 {
+		data, _ := json.Marshal(confs)
+		t.Fatalf("exported priorities expected; got: %s", data)
+	}
+	exported, errs := NewRouter(confs)
+	if len(errs) > 0 {
+		t.Fatalf("rebuild errors: %v", errs)
+	}
+	if got, _ := json.Marshal(exported); string(got) != string(expected) {
+		t.Errorf("rebuilt router differs.\nexpected: %s\ngot: %s", expected, got)
+	}
+}
+
+func TestPriorityPerPattern(t *testing.T) {
+	router, errs := NewRouter([]*LocationConf{
+		{Target: "A", Priority: 5, MappingConf: []*MappingBlock{{Domains: []string{"a.com"}, Locations: []string{"/u/:x"}}}},
+		{Target: "B", MappingConf: []*MappingBlock{{Domains: []string{"a.com"}, Locations: []string{"/u/:y"}}}},
+	})
+	if len(errs) > 0 {
+		t.Fatalf("NewRouter errors: %v", errs)
+	}
+	priorities := make(map[interface{}]int, 2)
+	for _, conf := range router.ExportConfs() {
+		priorities[conf.Target] = conf.MappingConf[0].Priority
+	}
+	if priorities["A"] != 5 || priorities["B"] != 0 {
+		t.Errorf("exported priorities expected: A 5, B 0; got: %v", priorities)
+	}
+}
+
+func TestPrioritySnapshot(t *testing.T) {
+	router, errs := NewRouter(getPriorityConfs(), WithConflictPolicy(ConflictError))
+	if len(errs) > 0 {
+		t.Fatalf("NewRouter errors: %v", errs)
+	}
+	data, err := router.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := new(DomainLocationRouter)
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if policy := loaded.DomainExactSearch["a.com"].conflict; policy != ConflictError {
+		t.Errorf("loaded conflict policy expected: %v; got: %v", ConflictError, policy)
+	}
+
+	expected, _ := json.Marshal(router.ExportConfs())
+	if got, _ := json.Marshal(loaded.ExportConfs()); string(got) != string(expected) {
+		t.Errorf("export of the loaded router differs.\nexpected: %s\ngot: %s", expected, got)
+	}
+	if _, errs := NewRouter(loaded.ExportConfs(), WithConflictPolicy(ConflictError)); len(errs) > 0 {
+		t.Errorf("rebuild errors: %v", errs)
+	}
+
+	//appending to the loaded router keeps checking conflicts at the restored priorities
+	dm := loaded.DomainExactSearch["a.com"]
+	if errs := dm.AppendConf(&DomainConf{Domain: "a.com", Target: "conflict", Locations: []string{"/p/"}, Priority: 10}); len(errs) != 1 {
+		t.Errorf("conflict of /p/ expected; got: %v", errs)
+	}
+}
@@ -0,0 +1,98 @@
+package dlrouter
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//LocationRef is a location of a domain router and its targets in matching order.
+type LocationRef struct {
+	Domain   string //the domain of the router, "_" or "_:<port>" for the default servers
+	Location string //the pattern: "= exact", "prefix" or "~ regex"
+	Kind     MatchKind
+	Targets  []interface{}
+}
+
+//DomainsByPrefix returns the domain routers whose domain starts with prefix, ordered by domain.
+//DomainsUnder finds the domains by their parent domain.
+func (m *DomainLocationRouter) DomainsByPrefix(prefix string) []*DomainRouter {
+	routers := make([]*DomainRouter, 0, 4)
+	for _, dm := range m.sortedDomainRouters() {
+		if strings.HasPrefix(dm.Domain, prefix) {
+			routers = append(routers, dm)
+		}
+	}
+	return routers
+}
+
+//eachLocation calls fn with every location of the domain routers, then of the default servers, ordered by
+//domain and location, until fn returns false.
+func (m *DomainLocationRouter) eachLocation(fn func(ref *LocationRef) bool) {
+	for _, dm := range append(m.sortedDomainRouters(), m.DefaultServers()...) {
+		locations := locationTargets(dm)
+		patterns := make([]string, 0, len(locations))
+		for pattern := range locations {
+			patterns = append(patterns, pattern)
+		}
+		sort.Strings(patterns)
+		for _, pattern := range patterns {
+			ref := &LocationRef{Domain: dm.Domain, Location: pattern, Kind: patternKind(pattern), Targets: locations[pattern]}
+			if !fn(ref) {
+				return
+			}
+		}
+	}
+}
+
+//LocationsWithPrefix returns the locations of every domain whose path starts with prefix: the exact and prefix
+//locations by their path, the regex locations by the literal prefix of their anchored regex.
+func (m *DomainLocationRouter) LocationsWithPrefix(prefix string) []*LocationRef {
+	refs := make([]*LocationRef, 0, 4)
+	m.eachLocation(func(ref *LocationRef) bool {
+		path := ref.Location
+		switch ref.Kind {
+		case MatchExact:
+			path = strings.TrimPrefix(path, "= ")
+		case MatchRegex:
+			path = regexLiteralPrefix(strings.TrimPrefix(path, "~ "))
+		}
+		if strings.HasPrefix(path, prefix) {
+			refs = append(refs, ref)
+		}
+		return true
+	})
+	return refs
+}
+
+//regexLiteralPrefix returns the literal prefix of the paths an expression anchored with ^ matches, or "".
+func regexLiteralPrefix(expr string) string {
+	if !strings.HasPrefix(expr, "^") {
+		return ""
+	}
+	re, err := regexp.Compile(expr[1:])
+	if err != nil {
+		return ""
+	}
+	prefix, _ := re.LiteralPrefix()
+	return prefix
+}
+
+//DomainsRouting returns the location of every domain router, default servers included, which the path
+//is routed to on a request of that domain, ordered by domain.
+func (m *DomainLocationRouter) DomainsRouting(path string) []*LocationRef {
+	refs := make([]*LocationRef, 0, 4)
+	for _, dm := range append(m.sortedDomainRouters(), m.DefaultServers()...) {
+		target, found := dm.getTarget(path)
+		if !found {
+			continue
+		}
+		refs = append(refs, &LocationRef{
+			Domain:   dm.Domain,
+			Location: target.Pattern,
+			Kind:     target.Kind(),
+			Targets:  dm.locationValues(target.Pattern),
+		})
+	}
+	return refs
+}
@@ -0,0 +1,91 @@
+package dlrouter
+
+import (
+	"fmt"
+	"testing"
+)
+
+func getQueryRouter(t *testing.T) *DomainLocationRouter {
+	router, errs := NewRouter([]*LocationConf{
+		{Target: "admin", MappingConf: []*MappingBlock{
+			{Domains: []string{"api.byted.org", "hotsoon.byted.org"}, Locations: []string{"/admin/", "= /admin"}},
+			{Locations: []string{"/admin/"}, DefaultServer: true},
+		}},
+		{Target: "api", MappingConf: []*MappingBlock{
+			{Domains: []string{"api.byted.org", "api.hotsoon.com"}, Locations: []string{"/", "~ ^/admin/v[0-9]+"}},
+		}},
+	})
+	if len(errs) > 0 {
+		t.Fatalf("NewRouter errors: %v", errs)
+	}
+	return router
+}
+
+func domainsOf(routers []*DomainRouter) []string {
+	domains := make([]string, 0, len(routers))
+	for _, dm := range routers {
+		domains = append(domains, dm.Domain)
+	}
+	return domains
+}
+
+func refsOf(refs []*LocationRef) []string {
+	locations := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		locations = append(locations, ref.Domain+" "+ref.Location)
+	}
+	return locations
+}
+
+func TestQueryDomains(t *testing.T) {
+	router := getQueryRouter(t)
+	queries := []struct {
+		name     string
+		routers  []*DomainRouter
+		expected string
+	}{
+		{"prefix api.", router.DomainsByPrefix("api."), "[api.byted.org api.hotsoon.com]"},
+		{"under byted.org", router.DomainsUnder("byted.org"), "[api.byted.org hotsoon.byted.org]"},
+	}
+	for _, q := range queries {
+		if got := fmt.Sprint(domainsOf(q.routers)); got != q.expected {
+			t.Errorf("domains of %s expected: %s; got: %s", q.name, q.expected, got)
+		}
+	}
+}
+
+func TestQueryLocations(t *testing.T) {
+	router := getQueryRouter(t)
+	queries := []struct {
+		name     string
+		refs     []*LocationRef
+		expected string
+	}{
+		{"with prefix /admin", router.LocationsWithPrefix("/admin"),
+			"[api.byted.org /admin/ api.byted.org = /admin api.byted.org ~ ^/admin/v[0-9]+ api.hotsoon.com ~ ^/admin/v[0-9]+ hotsoon.byted.org /admin/ hotsoon.byted.org = /admin _ /admin/]"},
+		{"routing /admin/users", router.DomainsRouting("/admin/users"),
+			"[api.byted.org /admin/ api.hotsoon.com / hotsoon.byted.org /admin/ _ /admin/]"},
+	}
+	for _, q := range queries {
+		if got := fmt.Sprint(refsOf(q.refs)); got != q.expected {
+			t.Errorf("locations %s expected: %s; got: %s", q.name, q.expected, got)
+		}
+	}
+	if refs := router.DomainsRouting("/admin"); refs[0].Kind != MatchExact || len(refs[0].Targets) != 1 {
+		t.Errorf("exact location of api.byted.org expected; got: %+v", refs[0])
+	}
+}
+
+func TestDomainsRoutingTargets(t *testing.T) {
+	router := getQueryRouter(t)
+	for _, ref := range router.DomainsRouting("/admin/v2") {
+		expected := router.RoutesForTarget(ref.Targets[0])
+		found := false
+		for _, e := range expected {
+			found = found || e.Domain == ref.Domain && e.Location == ref.Location && fmt.Sprint(e.Targets) == fmt.Sprint(ref.Targets)
+		}
+		if !found {
+			t.Errorf("location %s %s expected among the routes of %v; got: %v", ref.Domain, ref.Location, ref.Targets[0], refsOf(expected))
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package dlrouter
+
+import (
+	"math/bits"
+	"regexp/syntax"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	//domains with more regex locations than this use a regexMatcher instead of trying every regex
+	multiRegexThreshold = 8
+)
+
+type acNode struct {
+	children map[byte]int
+	fail     int
+	out      []int //indexes of the regexes whose required literal ends at this node
+}
+
+//regexMatcher narrows down the regex locations of a domain with an Aho-Corasick automaton built from the
+//literals every match of a regex must contain. Only the regexes whose literal occurs in the path, and those
+//without any required literal, are evaluated, in configuration order, so the winners are the same as trying
+//the regexes one by one.
+type regexMatcher struct {
+	regexes []*RegexTarget
+	always  []int //indexes of the regexes without a required literal
+	nodes   []acNode
+}
+
+func newRegexMatcher(regexes []*RegexTarget) *regexMatcher {
+	rm := &regexMatcher{
+		regexes: regexes,
+		always:  make([]int, 0, 2),
+		nodes:   []acNode{{children: make(map[byte]int, 2)}},
+	}
+
+	for idx, regexTar := range regexes {
+		literal := requiredLiteral(regexTar.RegexExp.String())
+		if len(literal) == 0 {
+			rm.always = append(rm.always, idx)
+			continue
+		}
+		state := 0
+		for i := 0; i < len(literal); i++ {
+			next, present := rm.nodes[state].children[literal[i]]
+			if !present {
+				next = len(rm.nodes)
+				rm.nodes = append(rm.nodes, acNode{children: make(map[byte]int, 1)})
+				rm.nodes[state].children[literal[i]] = next
+			}
+			state = next
+		}
+		rm.nodes[state].out = append(rm.nodes[state].out, idx)
+	}
+
+	//link the failure transitions breadth first, merging the outputs of the failure targets
+	queue := make([]int, 0, len(rm.nodes))
+	for _, child := range rm.nodes[0].children {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for c, child := range rm.nodes[state].children {
+			fail := rm.nodes[state].fail
+			for fail != 0 && !rm.hasChild(fail, c) {
+				fail = rm.nodes[fail].fail
+			}
+			if next, present := rm.nodes[fail].children[c]; present && next != child {
+				fail = next
+			} else {
+				fail = 0
+			}
+			rm.nodes[child].fail = fail
+			rm.nodes[child].out = append(rm.nodes[child].out, rm.nodes[fail].out...)
+			queue = append(queue, child)
+		}
+	}
+	return rm
+}
+
+//matcher returns the regexMatcher of the regex locations of the router, or nil if there are not more than
+//multiRegexThreshold of them. It is built by the first lookup rather than by AppendConf, so that appending
+//the confs of a domain one by one does not rebuild it every time; regex locations appended later build it again.
+func (dm *DomainRouter) matcher() *regexMatcher {
+	if len(dm.regexOrder) <= multiRegexThreshold {
+		return nil
+	}
+	rm := dm.regexMatcher.Load()
+	if rm == nil || len(rm.regexes) != len(dm.regexOrder) {
+		rm = newRegexMatcher(dm.regexOrder[:len(dm.regexOrder):len(dm.regexOrder)])
+		dm.regexMatcher.Store(rm)
+	}
+	return rm
+}
+
+func (rm *regexMatcher) hasChild(state int, c byte) bool {
+	_, present := rm.nodes[state].children[c]
+	return present
+}
+
+//eachMatch calls fn with every regex matching path in configuration order until fn returns false.
+func (rm *regexMatcher) eachMatch(path string, fn func(*RegexTarget) bool) {
+	var candidateBuf [8]uint64 //bitset of the regexes to evaluate
+	var candidates []uint64
+	if words := (len(rm.regexes) + 63) / 64; words <= len(candidateBuf) {
+		candidates = candidateBuf[:words]
+	} else {
+		candidates = make([]uint64, words)
+	}
+
+	for _, idx := range rm.always {
+		candidates[idx/64] |= 1 << uint(idx%64)
+	}
+	state := 0
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		for state != 0 && !rm.hasChild(state, c) {
+			state = rm.nodes[state].fail
+		}
+		state = rm.nodes[state].children[c] //the missing child yields the root
+		for _, idx := range rm.nodes[state].out {
+			candidates[idx/64] |= 1 << uint(idx%64)
+		}
+	}
+
+	for w, word := range candidates {
+		for ; word != 0; word &= word - 1 {
+			regexTar := rm.regexes[w*64+bits.TrailingZeros64(word)]
+			if regexTar.RegexExp.MatchString(path) && !fn(regexTar) {
+				return
+			}
+		}
+	}
+}
+
+//requiredLiteral returns the longest literal every match of the regular expression contains,
+//or an empty string if there is none.
+func requiredLiteral(expr string) string {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	literal := longestLiteral(re.Simplify())
+	if strings.ContainsRune(literal, utf8.RuneError) {
+		//invalid bytes in the path match U+FFFD, which is not a byte literal
+		return ""
+	}
+	return literal
+}
+
+func longestLiteral(re *syntax.Regexp) string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return ""
+		}
+		return string(re.Rune)
+	case syntax.OpCapture, syntax.OpPlus:
+		return longestLiteral(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min > 0 {
+			return longestLiteral(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		longest, run := "", ""
+		for _, sub := range re.Sub {
+			if sub.Op == syntax.OpLiteral && sub.Flags&syntax.FoldCase == 0 {
+				run += string(sub.Rune)
+				if len(run) > len(longest) {
+					longest = run
+				}
+				continue
+			}
+			run = ""
+			if literal := longestLiteral(sub); len(literal) > len(longest) {
+				longest = literal
+			}
+		}
+		return longest
+	}
+	return ""
+}
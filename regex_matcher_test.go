@@ -0,0 +1,101 @@
+package dlrouter
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+func getRegexLocations(n int) []string {
+	locations := make([]string, 0, n+4)
+	for i := 0; i < n; i++ {
+		locations = append(locations, fmt.Sprintf("~ /api/v%d/item/[0-9]+", i))
+	}
+	locations = append(locations,
+		"~ ^/static/.*\\.(png|jpg)$",
+		"~ (?i)/ADMIN/[a-z]+",
+		"~ /api/v1/.*",
+		"~ [0-9]+/comments",
+	)
+	return locations
+}
+
+func TestRequiredLiteral(t *testing.T) {
+	cases := map[string]string{
+		"/api/video/detail/[0-9]+":         "/api/video/detail/",
+		"^/static/.*\\.(png|jpg)$":         "/static/",
+		"(?i)/admin":                       "",
+		"[0-9]+/comments/(abc)+":           "/comments/",
+		"/a(/bcdefgh)?/[0-9]+/longer_part": "/longer_part",
+	}
+	for expr, expected := range cases {
+		if literal := requiredLiteral(expr); literal != expected {
+			t.Errorf("required literal of %s expected: %q; got: %q", expr, expected, literal)
+		}
+	}
+}
+
+func TestRegexMatcherSameAsSequential(t *testing.T) {
+	dm := NewDomainRouter("regex.byted.org")
+	for i, location := range getRegexLocations(200) {
+		if errs := dm.AppendConf(&DomainConf{
+			Domain:    "regex.byted.org",
+			Locations: []string{location},
+			Target:    i,
+		}); len(errs) > 0 {
+			t.Fatalf("append conf errors: %v", errs)
+		}
+	}
+	if dm.regexMatcher.Load() != nil {
+		t.Fatalf("expected the combined regex matcher to be built by the first lookup")
+	}
+	if dm.matcher() == nil {
+		t.Fatalf("expected the combined regex matcher for %d regex locations", len(dm.regexOrder))
+	}
+
+	paths := []string{
+		"/api/v1/item/123", "/api/v150/item/9/comments", "/api/v199/item/x", "/static/a/b.png",
+		"/x/admin/page", "/api/v1/other", "/p/42/comments", "/nothing/here", "",
+	}
+	for _, path := range paths {
+		expected := make([]interface{}, 0, 4)
+		for _, regexTar := range dm.regexOrder {
+			if regexp.MustCompile(regexTar.RegexExp.String()).MatchString(path) {
+				expected = append(expected, regexTar.Targets...)
+			}
+		}
+		targets, _ := dm.GetTargetsForPath(path, true)
+		if len(targets) != len(expected) {
+			t.Errorf("%s expected: %v; got: %v", path, expected, targets)
+			continue
+		}
+		for i, target := range targets {
+			if target.Value != expected[i] {
+				t.Errorf("%s target %d expected: %v; got: %v", path, i, expected[i], target.Value)
+			}
+		}
+		target, matched := dm.GetTargetsForPath(path, false)
+		if matched != (len(expected) > 0) || matched && target[0].Value != expected[0] {
+			t.Errorf("%s first target expected: %v; got: %v", path, expected, target)
+		}
+	}
+
+	//a regex location appended after a lookup builds the matcher again
+	dm.AppendConf(&DomainConf{Domain: "regex.byted.org", Locations: []string{"~ ^/late/[0-9]+$"}, Target: "late"})
+	if targets, found := dm.GetTargetsForPath("/late/42", false); !found || targets[0].Value != "late" {
+		t.Errorf("/late/42 expected: late; got: %v", targets)
+	}
+}
+
+func BenchmarkGetSceneManyRegex(b *testing.B) {
+	dm := NewDomainRouter("regex.byted.org")
+	dm.AppendConf(&DomainConf{
+		Domain:    "regex.byted.org",
+		Locations: getRegexLocations(500),
+		Target:    1,
+	})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		dm.GetTargetsForPath("/api/v499/item/123", false)
+	}
+}
@@ -0,0 +1,180 @@
+//Package replay routes the requests of access logs through dlrouter routers, to check a configuration
+//against real traffic before deploying it.
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/conndots/dlrouter"
+)
+
+//Format is the format of the lines of an access log.
+type Format uint8
+
+const (
+	FormatAuto     Format = iota //JSON for the lines starting with '{', nginx combined otherwise
+	FormatCombined               //the nginx combined log format
+	FormatJSON                   //a JSON object per line
+)
+
+var formatNames = [...]string{
+	FormatAuto:     "auto",
+	FormatCombined: "combined",
+	FormatJSON:     "json",
+}
+
+func (f Format) String() string {
+	if int(f) < len(formatNames) {
+		return formatNames[f]
+	}
+	return "unknown"
+}
+
+//ParseFormat returns the Format of a name of String.
+func ParseFormat(name string) (Format, bool) {
+	for f, n := range formatNames {
+		if n == name {
+			return Format(f), true
+		}
+	}
+	return FormatAuto, false
+}
+
+var (
+	//$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"
+	combinedRegex = regexp.MustCompile(`^\S+ \S+ \S+ \[[^\]]*\] "(\S+) (\S+)[^"]*" \d{3} `)
+
+	//the keys of the JSON lines holding the host and the path, tried in order
+	jsonHostKeys = []string{"host", "http_host", "domain", "server_name"}
+	jsonPathKeys = []string{"path", "uri", "request_uri", "url"}
+)
+
+//Reader reads the requests of an access log.
+//
+//The combined format has no host: the request is of the host of an absolute request URI, or of the default host.
+//The JSON lines have the host in one of the keys host, http_host, domain or server_name, and the path in one of
+//path, uri, request_uri or url, which may also be absolute. Query strings are dropped, and paths are decoded as
+//net/http decodes the URL path of a request, which Middleware routes by.
+type Reader struct {
+	scanner     *bufio.Scanner
+	format      Format
+	defaultHost string
+
+	request   dlrouter.Request
+	lines     int
+	malformed int
+}
+
+func NewReader(r io.Reader, format Format, defaultHost string) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return &Reader{
+		scanner:     scanner,
+		format:      format,
+		defaultHost: defaultHost,
+	}
+}
+
+//Next reads the next request, skipping the empty and malformed lines. It returns false at the end of the log
+//or on a read error, returned by Err.
+func (r *Reader) Next() bool {
+	for r.scanner.Scan() {
+		line := strings.TrimSpace(r.scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		r.lines++
+		format := r.format
+		if format == FormatAuto {
+			format = FormatCombined
+			if line[0] == '{' {
+				format = FormatJSON
+			}
+		}
+		var ok bool
+		if format == FormatJSON {
+			r.request, ok = r.parseJSON(line)
+		} else {
+			r.request, ok = r.parseCombined(line)
+		}
+		if ok {
+			return true
+		}
+		r.malformed++
+	}
+	return false
+}
+
+//Request returns the request read by Next.
+func (r *Reader) Request() dlrouter.Request {
+	return r.request
+}
+
+func (r *Reader) Err() error {
+	return r.scanner.Err()
+}
+
+//Lines returns the number of the lines read, empty lines aside.
+func (r *Reader) Lines() int {
+	return r.lines
+}
+
+//Malformed returns the number of the lines skipped as malformed.
+func (r *Reader) Malformed() int {
+	return r.malformed
+}
+
+func (r *Reader) parseCombined(line string) (dlrouter.Request, bool) {
+	match := combinedRegex.FindStringSubmatch(line)
+	if match == nil {
+		return dlrouter.Request{}, false
+	}
+	return r.newRequest("", match[2])
+}
+
+func (r *Reader) parseJSON(line string) (dlrouter.Request, bool) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		return dlrouter.Request{}, false
+	}
+	return r.newRequest(stringField(fields, jsonHostKeys), stringField(fields, jsonPathKeys))
+}
+
+func stringField(fields map[string]interface{}, keys []string) string {
+	for _, key := range keys {
+		if s, ok := fields[key].(string); ok && len(s) > 0 {
+			return s
+		}
+	}
+	return ""
+}
+
+//newRequest makes a request of host and of uri, a path or an absolute URI, with the default host if there is none.
+func (r *Reader) newRequest(host, uri string) (dlrouter.Request, bool) {
+	if len(uri) == 0 {
+		return dlrouter.Request{}, false
+	}
+	u, err := url.ParseRequestURI(uri) //as net/http parses the request line
+	if err != nil || uri[0] != '/' && len(u.Host) == 0 {
+		return dlrouter.Request{}, false
+	}
+	if len(host) == 0 {
+		host = u.Host
+	}
+	path := u.Path
+	if len(path) == 0 {
+		path = "/"
+	}
+	if len(host) == 0 {
+		host = r.defaultHost
+	}
+	if len(host) == 0 {
+		return dlrouter.Request{}, false
+	}
+	return dlrouter.Request{Domain: host, Path: path}, true
+}
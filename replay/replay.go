@@ -0,0 +1,178 @@
+package replay
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/conndots/dlrouter"
+)
+
+//LocationKey is a location of a domain router.
+type LocationKey struct {
+	Domain   string //the domain of the router, "_" or "_:<port>" for the default servers
+	Location string //the pattern: "= exact", "prefix" or "~ regex"
+}
+
+//Count is a request and the number of its occurrences.
+type Count struct {
+	Request dlrouter.Request
+	Count   int
+}
+
+//Change is a request routed to another target by the new router, with the number of its occurrences.
+type Change struct {
+	Request  dlrouter.Request
+	Old, New *dlrouter.Target //nil if the request is not routed
+	Count    int
+}
+
+//Report is the result of a replay. With two routers, the hits and the unmatched requests are the ones
+//of the new router.
+type Report struct {
+	Requests  int
+	Malformed int
+	Hits      map[LocationKey]int
+	Unmatched []*Count  //in the order of their first occurrences
+	Changes   []*Change //in the order of their first occurrences
+
+	unmatched map[dlrouter.Request]*Count
+	changes   map[dlrouter.Request]*Change
+}
+
+func newReport() *Report {
+	return &Report{
+		Hits:      make(map[LocationKey]int, 16),
+		Unmatched: make([]*Count, 0, 4),
+		Changes:   make([]*Change, 0, 4),
+		unmatched: make(map[dlrouter.Request]*Count, 4),
+		changes:   make(map[dlrouter.Request]*Change, 4),
+	}
+}
+
+//Replay routes the requests of r with router.
+func Replay(r *Reader, router *dlrouter.DomainLocationRouter) (*Report, error) {
+	return Compare(r, nil, router)
+}
+
+//Compare routes the requests of r with both routers, and reports the requests whose target changed from
+//oldRouter to newRouter. A nil oldRouter compares nothing.
+func Compare(r *Reader, oldRouter, newRouter *dlrouter.DomainLocationRouter) (*Report, error) {
+	report := newReport()
+	for r.Next() {
+		req := r.Request()
+		report.Requests++
+		dm, target, found := newRouter.Lookup(req.Domain, req.Path)
+		if found {
+			report.Hits[LocationKey{Domain: dm.Domain, Location: target.Pattern}]++
+		} else {
+			report.addUnmatched(req)
+		}
+		if oldRouter == nil {
+			continue
+		}
+		oldTarget, oldFound := oldRouter.GetTarget(req.Domain, req.Path)
+		if found != oldFound || found && !dlrouter.SameTarget(oldTarget.Value, target.Value) {
+			report.addChange(req, oldTarget, target)
+		}
+	}
+	report.Malformed = r.Malformed()
+	return report, r.Err()
+}
+
+func (rp *Report) addUnmatched(req dlrouter.Request) {
+	count, present := rp.unmatched[req]
+	if !present {
+		count = &Count{Request: req}
+		rp.unmatched[req] = count
+		rp.Unmatched = append(rp.Unmatched, count)
+	}
+	count.Count++
+}
+
+func (rp *Report) addChange(req dlrouter.Request, oldTarget, newTarget *dlrouter.Target) {
+	change, present := rp.changes[req]
+	if !present {
+		change = &Change{Request: req, Old: oldTarget, New: newTarget}
+		rp.changes[req] = change
+		rp.Changes = append(rp.Changes, change)
+	}
+	change.Count++
+}
+
+//Coverage returns the ratio of the requests routed.
+func (rp *Report) Coverage() float64 {
+	if rp.Requests == 0 {
+		return 0
+	}
+	unmatched := 0
+	for _, count := range rp.Unmatched {
+		unmatched += count.Count
+	}
+	return float64(rp.Requests-unmatched) / float64(rp.Requests)
+}
+
+//SortedHits returns the locations hit, the most hit first, then ordered by domain and location.
+func (rp *Report) SortedHits() []LocationKey {
+	keys := make([]LocationKey, 0, len(rp.Hits))
+	for key := range rp.Hits {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if rp.Hits[keys[i]] != rp.Hits[keys[j]] {
+			return rp.Hits[keys[i]] > rp.Hits[keys[j]]
+		}
+		if keys[i].Domain != keys[j].Domain {
+			return keys[i].Domain < keys[j].Domain
+		}
+		return keys[i].Location < keys[j].Location
+	})
+	return keys
+}
+
+//Write writes the report as text.
+func (rp *Report) Write(w io.Writer) error {
+	rw := &reportWriter{w: bufio.NewWriter(w)}
+	rw.printf("requests: %d, malformed lines: %d, coverage: %.2f%%\n", rp.Requests, rp.Malformed, rp.Coverage()*100)
+	rw.printf("hits:\n")
+	for _, key := range rp.SortedHits() {
+		rw.printf("  %d\t%s %s\n", rp.Hits[key], key.Domain, key.Location)
+	}
+	if len(rp.Unmatched) > 0 {
+		rw.printf("unmatched:\n")
+		for _, count := range rp.Unmatched {
+			rw.printf("  %d\t%s%s\n", count.Count, count.Request.Domain, count.Request.Path)
+		}
+	}
+	if len(rp.Changes) > 0 {
+		rw.printf("changed:\n")
+		for _, change := range rp.Changes {
+			rw.printf("  %d\t%s%s: %s => %s\n", change.Count, change.Request.Domain, change.Request.Path,
+				targetString(change.Old), targetString(change.New))
+		}
+	}
+
+	if rw.err != nil {
+		return rw.err
+	}
+	return rw.w.Flush()
+}
+
+func targetString(t *dlrouter.Target) string {
+	if t == nil {
+		return "not found"
+	}
+	return fmt.Sprintf("%v (%s)", t.Value, t.Pattern)
+}
+
+type reportWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (rw *reportWriter) printf(format string, args ...interface{}) {
+	if rw.err == nil {
+		_, rw.err = fmt.Fprintf(rw.w, format, args...)
+	}
+}
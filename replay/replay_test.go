@@ -0,0 +1,137 @@
+package replay
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/conndots/dlrouter"
+)
+
+const accessLog = `127.0.0.1 - - [10/Oct/2026:13:55:36 +0000] "GET /cart/1?x=1 HTTP/1.1" 200 2326 "-" "curl/8.0"
+127.0.0.1 - frank [10/Oct/2026:13:55:37 +0000] "GET http://search.shop.com/q HTTP/1.1" 200 12 "-" "-"
+{"host": "shop.com", "uri": "/cart/2", "status": 200}
+{"http_host": "shop.com", "request_uri": "/missing?id=3"}
+{"host": "shop.com", "request_uri": "/missing"}
+
+not a log line
+{"host": "shop.com"}
+127.0.0.1 - - [10/Oct/2026:13:55:38 +0000] "GET /basket/ HTTP/1.1" 404 0 "-" "-"
+`
+
+func getReplayRouter(t *testing.T, cartLocations ...string) *dlrouter.DomainLocationRouter {
+	router, errs := dlrouter.NewRouter([]*dlrouter.LocationConf{
+		{Target: "cart", MappingConf: []*dlrouter.MappingBlock{{Domains: []string{"shop.com"}, Locations: cartLocations}}},
+		{Target: "search", MappingConf: []*dlrouter.MappingBlock{{Domains: []string{"search.shop.com"}, Locations: []string{"/"}}}},
+	})
+	if len(errs) > 0 {
+		t.Fatalf("NewRouter errors: %v", errs)
+	}
+	return router
+}
+
+func TestReader(t *testing.T) {
+	r := NewReader(strings.NewReader(accessLog), FormatAuto, "shop.com")
+	requests := make([]dlrouter.Request, 0, 8)
+	for r.Next() {
+		requests = append(requests, r.Request())
+	}
+	expected := []dlrouter.Request{
+		{Domain: "shop.com", Path: "/cart/1"},
+		{Domain: "search.shop.com", Path: "/q"},
+		{Domain: "shop.com", Path: "/cart/2"},
+		{Domain: "shop.com", Path: "/missing"},
+		{Domain: "shop.com", Path: "/missing"},
+		{Domain: "shop.com", Path: "/basket/"},
+	}
+	if len(requests) != len(expected) {
+		t.Fatalf("requests expected: %v; got: %v", expected, requests)
+	}
+	for i := range expected {
+		if requests[i] != expected[i] {
+			t.Errorf("request %d expected: %v; got: %v", i, expected[i], requests[i])
+		}
+	}
+	if r.Lines() != 8 || r.Malformed() != 2 || r.Err() != nil {
+		t.Errorf("8 lines, 2 malformed expected; got: %d, %d, %v", r.Lines(), r.Malformed(), r.Err())
+	}
+
+	r = NewReader(strings.NewReader(accessLog), FormatJSON, "")
+	count := 0
+	for r.Next() {
+		count++
+	}
+	if count != 3 || r.Malformed() != 5 {
+		t.Errorf("3 JSON requests expected; got: %d, %d malformed", count, r.Malformed())
+	}
+}
+
+func TestReplay(t *testing.T) {
+	report, err := Replay(NewReader(strings.NewReader(accessLog), FormatAuto, "shop.com"), getReplayRouter(t, "/cart/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Requests != 6 || report.Malformed != 2 || report.Hits[LocationKey{"shop.com", "/cart/"}] != 2 {
+		t.Errorf("6 requests, 2 hits of /cart/ expected; got: %+v", report)
+	}
+	if len(report.Unmatched) != 2 || report.Unmatched[0].Count != 2 || report.Coverage() != 0.5 {
+		t.Errorf("unmatched /missing x2 and /basket/ expected; got: %v, coverage %v", report.Unmatched, report.Coverage())
+	}
+}
+
+func TestCompare(t *testing.T) {
+	oldRouter := getReplayRouter(t, "/cart/")
+	newRouter := getReplayRouter(t, "/cart/1", "/basket/")
+	report, err := Compare(NewReader(strings.NewReader(accessLog), FormatAuto, "shop.com"), oldRouter, newRouter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := report.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `requests: 6, malformed lines: 2, coverage: 50.00%
+hits:
+  1	search.shop.com /
+  1	shop.com /basket/
+  1	shop.com /cart/1
+unmatched:
+  1	shop.com/cart/2
+  2	shop.com/missing
+changed:
+  1	shop.com/cart/2: cart (/cart/) => not found
+  1	shop.com/basket/: not found => cart (/basket/)
+`
+	if buf.String() != expected {
+		t.Errorf("report expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestReplaySameAsMiddleware(t *testing.T) {
+	router, errs := dlrouter.NewRouter([]*dlrouter.LocationConf{
+		{Target: "decoded", MappingConf: []*dlrouter.MappingBlock{{Domains: []string{"shop.com"}, Locations: []string{"= /cart/a b"}}}},
+		{Target: "encoded", MappingConf: []*dlrouter.MappingBlock{{Domains: []string{"shop.com"}, Locations: []string{"= /cart/a%20b"}}}},
+	})
+	if len(errs) > 0 {
+		t.Fatalf("NewRouter errors: %v", errs)
+	}
+	var served interface{}
+	handler := router.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if target, found := dlrouter.TargetFromContext(r.Context()); found {
+			served = target.Value
+		}
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://shop.com/cart/a%20b?x=1", nil))
+
+	line := `127.0.0.1 - - [10/Oct/2026:13:55:36 +0000] "GET /cart/a%20b?x=1 HTTP/1.1" 200 2326 "-" "curl/8.0"`
+	report, err := Replay(NewReader(strings.NewReader(line), FormatAuto, "shop.com"), router)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := LocationKey{Domain: "shop.com", Location: "= /cart/a b"}
+	if served != "decoded" || report.Hits[key] != 1 {
+		t.Errorf("decoded path expected by the middleware and the replay; got: %v, %v", served, report.Hits)
+	}
+}
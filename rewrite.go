@@ -0,0 +1,204 @@
+package dlrouter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+//flags of the rewrite rules, as the flags of the nginx rewrite directive
+const (
+	RewriteNone      = ""          //rewrite the path and go on with the next rule, searching the locations again after the last one
+	RewriteLast      = "last"      //rewrite the path and search the locations again
+	RewriteBreak     = "break"     //rewrite the path and stop, keeping the matched location
+	RewriteRedirect  = "redirect"  //respond with a 302 redirect to the replacement
+	RewritePermanent = "permanent" //respond with a 301 redirect to the replacement
+
+	maxInternalRewrites = 10
+)
+
+var (
+	RewriteLocationErr = errors.New("[dlrouter compile] the rewritten location is not a location of the block")
+	RewriteFlagErr     = errors.New("[dlrouter compile] unknown rewrite flag")
+	RewriteLoopErr     = errors.New("[dlrouter resolve] rewrite cycle or too many internal rewrites")
+)
+
+//RewriteConf is a rewrite rule of a location. When the path matched by the location matches Regex, it is
+//replaced by Replacement, in which $1 or ${name} are the submatches of Regex and :var the path variables of the
+//location. A replacement starting with http:// or https:// is always a redirect.
+type RewriteConf struct {
+	Location    string `yaml:"location" json:"location"`
+	Regex       string `yaml:"regex,omitempty" json:"regex,omitempty"` //an empty regex matches every path
+	Replacement string `yaml:"replacement" json:"replacement"`
+	Flag        string `yaml:"flag,omitempty" json:"flag,omitempty"`
+}
+
+type rewriteRule struct {
+	conf   *RewriteConf //with the location normalized
+	regex  *regexp.Regexp
+	target interface{} //target of the configuration of the rule
+}
+
+//Redirect is the response of a rewrite rule redirecting the request.
+type Redirect struct {
+	Code     int
+	Location string
+}
+
+//Resolution is the result of Resolve. Target and Redirect are nil if no location matches.
+type Resolution struct {
+	Target   *Target   //target of the location matched last, nil for redirects
+	Path     string    //the path after the rewrites
+	Redirect *Redirect //set when a rewrite rule redirects
+	Paths    []string  //the paths looked up, starting with the requested one
+}
+
+//addRewrites compiles the rewrite rules of dconf. The returned errors are *CompileError.
+func (dm *DomainRouter) addRewrites(dconf *DomainConf) []error {
+	errs := make([]error, 0, 1)
+	for _, rw := range dconf.Rewrites {
+		location := normalizeLocation(rw.Location)
+		found := false
+		for _, l := range dconf.Locations {
+			if normalizeLocation(l) == location {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, dm.newCompileError(CompileErrorRewrite, location, dconf.Pos, RewriteLocationErr))
+			continue
+		}
+		switch rw.Flag {
+		case RewriteNone, RewriteLast, RewriteBreak, RewriteRedirect, RewritePermanent:
+		default:
+			errs = append(errs, dm.newCompileError(CompileErrorRewrite, location, dconf.Pos, fmt.Errorf("%w: %s", RewriteFlagErr, rw.Flag)))
+			continue
+		}
+		regex, err := regexp.Compile(rw.Regex)
+		if err != nil {
+			errs = append(errs, dm.newCompileError(CompileErrorRewrite, location, dconf.Pos, err))
+			continue
+		}
+
+		conf := *rw
+		conf.Location = location
+		dm.addRewriteRule(&rewriteRule{conf: &conf, regex: regex, target: dconf.Target})
+	}
+	return errs
+}
+
+func (dm *DomainRouter) addRewriteRule(rule *rewriteRule) {
+	if dm.rewrites == nil {
+		dm.rewrites = make(map[string][]*rewriteRule, 2)
+	}
+	dm.rewrites[rule.conf.Location] = append(dm.rewrites[rule.conf.Location], rule)
+}
+
+//rewriteRules returns the rewrite rules ordered by location, in configuration order per location.
+func (dm *DomainRouter) rewriteRules() []*rewriteRule {
+	locations := make([]string, 0, len(dm.rewrites))
+	for location := range dm.rewrites {
+		locations = append(locations, location)
+	}
+	sort.Strings(locations)
+	rules := make([]*rewriteRule, 0, len(locations))
+	for _, location := range locations {
+		rules = append(rules, dm.rewrites[location]...)
+	}
+	return rules
+}
+
+//rewrite applies the rewrite rules of the location of target to path. It returns the rewritten path and whether
+//the locations have to be searched again, or a redirect.
+func (dm *DomainRouter) rewrite(target *Target, path string) (string, bool, *Redirect) {
+	changed := false
+	for _, rule := range dm.rewrites[target.Pattern] {
+		match := rule.regex.FindStringSubmatchIndex(path)
+		if match == nil {
+			continue
+		}
+		replacement := string(rule.regex.ExpandString(nil, expandPathVars(rule.conf.Replacement, target.Variables), path, match))
+
+		switch {
+		case rule.conf.Flag == RewritePermanent:
+			return "", false, &Redirect{Code: http.StatusMovedPermanently, Location: replacement}
+		case rule.conf.Flag == RewriteRedirect || strings.HasPrefix(replacement, "http://") || strings.HasPrefix(replacement, "https://"):
+			return "", false, &Redirect{Code: http.StatusFound, Location: replacement}
+		}
+		path = replacement
+		changed = true
+		switch rule.conf.Flag {
+		case RewriteBreak:
+			return path, false, nil
+		case RewriteLast:
+			return path, true, nil
+		}
+	}
+	return path, changed, nil
+}
+
+//expandPathVars replaces the :var of the template with the path variables, escaping them for regexp.Expand.
+func expandPathVars(template string, vars map[string]string) string {
+	if len(vars) == 0 || strings.IndexByte(template, ':') < 0 {
+		return template
+	}
+	var sb strings.Builder
+	for {
+		pos := strings.IndexByte(template, ':')
+		if pos < 0 {
+			sb.WriteString(template)
+			return sb.String()
+		}
+		sb.WriteString(template[:pos])
+		end := pos + 1
+		for end < len(template) && isVarNameByte(template[end]) {
+			end++
+		}
+		if value, present := vars[template[pos+1:end]]; present && end > pos+1 {
+			sb.WriteString(strings.ReplaceAll(value, "$", "$$"))
+		} else {
+			sb.WriteString(template[pos:end])
+		}
+		template = template[end:]
+	}
+}
+
+func isVarNameByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+//Resolve looks up the target of domain and path, applying the rewrite rules of the locations matched.
+//Internal rewrites search the locations of domain again with the rewritten path, up to 10 times;
+//RewriteLoopErr is returned for longer chains and for chains coming back to a path.
+func (m *DomainLocationRouter) Resolve(domain, path string) (*Resolution, error) {
+	res := &Resolution{Path: path, Paths: make([]string, 0, 1)}
+	for {
+		res.Paths = append(res.Paths, res.Path)
+		dm, target, found := m.Lookup(domain, res.Path)
+		if !found {
+			res.Target = nil
+			return res, nil
+		}
+		res.Target = target
+
+		next, again, redirect := dm.rewrite(target, res.Path)
+		if redirect != nil {
+			res.Target = nil
+			res.Redirect = redirect
+			return res, nil
+		}
+		if !again {
+			res.Path = next
+			return res, nil
+		}
+		if slices.Contains(res.Paths, next) || len(res.Paths) > maxInternalRewrites {
+			return res, fmt.Errorf("%w: %s -> %s", RewriteLoopErr, strings.Join(res.Paths, " -> "), next)
+		}
+		res.Path = next
+	}
+}
@@ -0,0 +1,129 @@
+package dlrouter
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func getRewriteRouter(t *testing.T) *DomainLocationRouter {
+	router, errs := NewRouter([]*LocationConf{
+		{
+			Target: "legacy",
+			MappingConf: []*MappingBlock{{
+				Domains:   []string{"shop.com"},
+				Locations: []string{"/old/", "= /home", "/users/:id/profile", "/loop/", "/chain/"},
+				Rewrites: []*RewriteConf{
+					{Location: "/old/", Regex: "^/old/(.*)$", Replacement: "/new/$1", Flag: RewriteLast},
+					{Location: "= /home", Replacement: "https://www.shop.com/", Flag: RewritePermanent},
+					{Location: "/users/:id/profile", Regex: "/profile$", Replacement: "/u/:id", Flag: RewriteBreak},
+					{Location: "/loop/", Regex: "^/loop/a$", Replacement: "/loop/b"},
+					{Location: "/loop/", Regex: "^/loop/b$", Replacement: "/loop/a", Flag: RewriteLast},
+					{Location: "/chain/", Regex: "^/chain/([0-9]+)$", Replacement: "/chain/${1}0", Flag: RewriteLast},
+				},
+			}},
+		},
+		{
+			Target: "new",
+			MappingConf: []*MappingBlock{{
+				Domains:   []string{"shop.com"},
+				Locations: []string{"/new/", "~ ^/a/"},
+				Rewrites:  []*RewriteConf{{Location: "~ ^/a/", Replacement: "/b/", Flag: RewriteRedirect}},
+			}},
+		},
+	})
+	if len(errs) > 0 {
+		t.Fatalf("NewRouter errors: %v", errs)
+	}
+	return router
+}
+
+func TestResolve(t *testing.T) {
+	router := getRewriteRouter(t)
+
+	res, err := router.Resolve("shop.com", "/old/cart")
+	if err != nil || res.Target == nil || res.Target.Value != "new" || res.Path != "/new/cart" {
+		t.Errorf("resolution expected: new /new/cart; got: %+v, %v", res, err)
+	}
+	if !reflect.DeepEqual(res.Paths, []string{"/old/cart", "/new/cart"}) {
+		t.Errorf("paths expected: [/old/cart /new/cart]; got: %v", res.Paths)
+	}
+
+	res, err = router.Resolve("shop.com", "/home")
+	if err != nil || res.Target != nil || res.Redirect == nil || *res.Redirect != (Redirect{301, "https://www.shop.com/"}) {
+		t.Errorf("redirect expected: 301 https://www.shop.com/; got: %+v, %v", res, err)
+	}
+	res, err = router.Resolve("shop.com", "/a/x")
+	if err != nil || res.Redirect == nil || *res.Redirect != (Redirect{302, "/b/"}) {
+		t.Errorf("redirect expected: 302 /b/; got: %+v, %v", res, err)
+	}
+
+	res, err = router.Resolve("shop.com", "/users/42/profile")
+	if err != nil || res.Target.Value != "legacy" || res.Path != "/u/42" || res.Target.Variables["id"] != "42" {
+		t.Errorf("resolution expected: legacy /u/42; got: %+v, %v", res, err)
+	}
+
+	res, err = router.Resolve("shop.com", "/missing")
+	if err != nil || res.Target != nil || res.Redirect != nil || res.Path != "/missing" {
+		t.Errorf("no resolution expected; got: %+v, %v", res, err)
+	}
+
+	if _, err = router.Resolve("shop.com", "/loop/a"); !errors.Is(err, RewriteLoopErr) {
+		t.Errorf("error expected: %v; got: %v", RewriteLoopErr, err)
+	}
+	if _, err = router.Resolve("shop.com", "/chain/1"); !errors.Is(err, RewriteLoopErr) {
+		t.Errorf("error expected: %v; got: %v", RewriteLoopErr, err)
+	}
+}
+
+func TestRewriteCompileErrors(t *testing.T) {
+	_, errs := NewRouter([]*LocationConf{{
+		Target: 1,
+		MappingConf: []*MappingBlock{{
+			Domains:   []string{"a.com"},
+			Locations: []string{"/a"},
+			Rewrites: []*RewriteConf{
+				{Location: "/b", Replacement: "/c"},
+				{Location: "/a", Replacement: "/c", Flag: "forever"},
+				{Location: "/a", Regex: "(", Replacement: "/c"},
+			},
+		}},
+	}})
+	if len(errs) != 3 || !errors.Is(errs[0], RewriteLocationErr) || !errors.Is(errs[1], RewriteFlagErr) {
+		t.Fatalf("rewrite compile errors expected; got: %v", errs)
+	}
+	var compileErr *CompileError
+	if !errors.As(errs[2], &compileErr) || compileErr.Kind != CompileErrorRewrite {
+		t.Errorf("rewrite compile error expected; got: %v", errs[2])
+	}
+}
+
+func TestRewritesRoundTrip(t *testing.T) {
+	router := getRewriteRouter(t)
+	expected, _ := json.Marshal(router)
+
+	exported, errs := NewRouter(router.ExportConfs())
+	if len(errs) > 0 {
+		t.Fatalf("rebuild errors: %v", errs)
+	}
+	if got, _ := json.Marshal(exported); string(got) != string(expected) {
+		t.Errorf("rebuilt router differs.\nexpected: %s\ngot: %s", expected, got)
+	}
+
+	data, err := router.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary error: %v", err)
+	}
+	loaded := &DomainLocationRouter{}
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary error: %v", err)
+	}
+	if got, _ := json.Marshal(loaded); string(got) != string(expected) {
+		t.Errorf("loaded router differs.\nexpected: %s\ngot: %s", expected, got)
+	}
+	res, err := loaded.Resolve("shop.com", "/old/cart")
+	if err != nil || res.Target == nil || res.Target.Value != "new" {
+		t.Errorf("resolution of loaded router expected: new; got: %+v, %v", res, err)
+	}
+}
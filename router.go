@@ -2,26 +2,78 @@ package dlrouter
 
 import (
 	"errors"
-	"fmt"
 	"regexp"
+	"sort"
 	"strings"
+	"sync/atomic"
 
 	"github.com/conndots/dlrouter/pathtree"
 )
 
-const (
-	domainSearchStageNum = 3
-)
 var (
 	NotSameDomainErr = errors.New("[dlrouter compile] domains are not identical")
 )
+
 type RegexTarget struct {
 	RegexExp *regexp.Regexp
 	Targets  []interface{}
+
+	targets []*Target //prebuilt results of Targets
+}
+
+func (rt *RegexTarget) add(target interface{}) {
+	rt.insert(len(rt.Targets), target)
+}
+
+func (rt *RegexTarget) insert(pos int, target interface{}) {
+	rt.Targets = insertValue(rt.Targets, pos, target)
+	rt.targets = insertTarget(rt.targets, pos, &Target{Value: target, Pattern: regexPattern(rt.RegexExp.String())})
 }
+
+//Target is a routing result. Targets returned by the routers may be shared between lookups and must not be modified.
+//Its layout is identical to pathtree.TargetCandidate so that prefix candidates are returned without copying.
 type Target struct {
-	Value interface{}
+	Value     interface{}
 	Variables map[string]string
+	Pattern   string //the location matched: "= exact", "prefix" or "~ regex"
+	Matched   int    //the length of the path matched by an exact or a prefix location
+}
+
+type MatchKind uint8
+
+const (
+	MatchExact MatchKind = iota
+	MatchPrefix
+	MatchRegex
+)
+
+var matchKindNames = [...]string{
+	MatchExact:  "exact",
+	MatchPrefix: "prefix",
+	MatchRegex:  "regex",
+}
+
+func (k MatchKind) String() string {
+	if int(k) < len(matchKindNames) {
+		return matchKindNames[k]
+	}
+	return "unknown"
+}
+
+//Kind returns the kind of the location matched, told by its Pattern.
+func (t *Target) Kind() MatchKind {
+	return patternKind(t.Pattern)
+}
+
+func patternKind(pattern string) MatchKind {
+	switch {
+	case strings.HasPrefix(pattern, pathConfTypeEqual+" "):
+		return MatchExact
+	case strings.HasPrefix(pattern, pathConfTypeRegex+" "):
+		return MatchRegex
+	default:
+		return MatchPrefix
+	}
 }
 
 type DomainRouter struct {
@@ -29,12 +81,27 @@ type DomainRouter struct {
 	LocationExactSearch  map[string][]interface{}
 	LocationPrefixSearch *pathtree.PathTree
 	LocationRegexSearch  map[string]*RegexTarget
+
+	exactTargets map[string][]*Target         //prebuilt results of LocationExactSearch
+	regexOrder   []*RegexTarget               //LocationRegexSearch in configuration order
+	regexMatcher atomic.Pointer[regexMatcher] //built by the first lookup once the domain has more than multiRegexThreshold regex locations
+	rewrites     map[string][]*rewriteRule    //rewrite rules by location pattern
+	priorities   map[string][]int             //priorities of the targets of the exact and regex locations by pattern
+	targets      *targetIndex                 //location patterns by target, see RoutesForTarget
+	conflict     ConflictPolicy
 }
 
 type DomainLocationRouter struct {
 	DomainExactSearch   map[string]*DomainRouter
-	DomainPostfixSearch *pathtree.PathTree
+	DomainPostfixSearch *pathtree.PathTree //keyed by the reversed labels of the domains, see GetReversedLabels
 	DomainPrefixSearch  *pathtree.PathTree
+
+	TargetCodec TargetCodec  //encodes the targets in snapshots, GobTargetCodec if nil
+	Tracer      LookupTracer //traces the lookups of GetTargetContext and Middleware if set
+
+	routes         map[string]*Route     //named locations by name
+	defaultServers map[int]*DomainRouter //default server routers by port, 0 for every port
+	policy         DomainPolicy
 }
 
 func NewDomainRouter(domain string) *DomainRouter {
@@ -43,20 +110,32 @@ func NewDomainRouter(domain string) *DomainRouter {
 		LocationExactSearch:  make(map[string][]interface{}, 3),
 		LocationPrefixSearch: pathtree.NewPathTree(),
 		LocationRegexSearch:  make(map[string]*RegexTarget, 3),
+		exactTargets:         make(map[string][]*Target, 3),
+		regexOrder:           make([]*RegexTarget, 0, 3),
+		targets:              newTargetIndex(),
 	}
 }
 
-func (dm *DomainRouter) newCompileError(location string, err error) error {
-	return fmt.Errorf("[dlrouter compile] Compile Error: %v. Domain: %s. Location: %s", err, dm.Domain, location)
+func (dm *DomainRouter) newCompileError(kind CompileErrorKind, location string, pos SourcePos, err error) error {
+	return &CompileError{
+		Kind:     kind,
+		Domain:   dm.Domain,
+		Location: location,
+		Pos:      pos,
+		Err:      err,
+	}
 }
+
+//AppendConf adds the locations of dconf to the router. The returned errors are *CompileError.
 func (dm *DomainRouter) AppendConf(dconf *DomainConf) []error {
 	if dconf.Domain != dm.Domain {
-		return []error{NotSameDomainErr}
+		return []error{dm.newCompileError(CompileErrorDomain, "", dconf.Pos, NotSameDomainErr)}
 	}
 
 	errs := make([]error, 0, 2)
+	priority := dm.priority(dconf)
 
-	for _, location := range dconf.Locations {
+	for i, location := range dconf.Locations {
 		location = strings.TrimSpace(location)
 
 		if len(location) == 0 {
@@ -65,117 +144,171 @@ func (dm *DomainRouter) AppendConf(dconf *DomainConf) []error {
 
 		if strings.Index(location, "= ") == 0 {
 			remain := strings.TrimSpace(location[2:])
-			tlist, exist := dm.LocationExactSearch[remain]
-			if exist {
-				tlist = append(tlist, dconf.Target)
-			} else {
-				tlist = []interface{}{dconf.Target}
+			pattern := exactPattern(remain)
+			tlist := dm.LocationExactSearch[remain]
+			if err := dm.checkConflict(tlist, dm.locationPriorities(pattern, len(tlist)), dconf.Target, priority); err != nil {
+				errs = append(errs, dm.newCompileError(CompileErrorConflict, location, dconf.locationPos(i), err))
+				continue
 			}
-			dm.LocationExactSearch[remain] = tlist
+			pos := dm.insertPriority(pattern, len(tlist), priority)
+			dm.LocationExactSearch[remain] = insertValue(tlist, pos, dconf.Target)
+			dm.exactTargets[remain] = insertTarget(dm.exactTargets[remain], pos, &Target{Value: dconf.Target, Pattern: pattern, Matched: len(remain)})
+			dm.targets.add(dconf.Target, pattern)
 		} else if strings.Index(location, "~ ") == 0 {
 			remain := strings.TrimSpace(location[2:])
 			regexExp, err := regexp.Compile(remain)
 			if err != nil {
-				errs = append(errs, dm.newCompileError(location, err))
+				errs = append(errs, dm.newCompileError(CompileErrorRegex, location, dconf.locationPos(i), err))
 				continue
 			} else {
 				target, exist := dm.LocationRegexSearch[remain]
-				if exist {
-					target.Targets = append(target.Targets, dconf.Target)
-				} else {
+				if !exist {
 					target = &RegexTarget{
 						RegexExp: regexExp,
-						Targets: []interface{}{dconf.Target},
+						Targets:  make([]interface{}, 0, 1),
 					}
 					dm.LocationRegexSearch[remain] = target
+					dm.regexOrder = append(dm.regexOrder, target)
 				}
+				pattern := regexPattern(remain)
+				if err := dm.checkConflict(target.Targets, dm.locationPriorities(pattern, len(target.Targets)), dconf.Target, priority); err != nil {
+					errs = append(errs, dm.newCompileError(CompileErrorConflict, location, dconf.locationPos(i), err))
+					continue
+				}
+				target.insert(dm.insertPriority(pattern, len(target.Targets), priority), dconf.Target)
+				dm.targets.add(dconf.Target, pattern)
 			}
 		} else {
-			err := dm.LocationPrefixSearch.Add(location, dconf.Target)
+			values, priorities := dm.LocationPrefixSearch.PatternValues(location)
+			if err := dm.checkConflict(values, priorities, dconf.Target, priority); err != nil {
+				errs = append(errs, dm.newCompileError(CompileErrorConflict, location, dconf.locationPos(i), err))
+				continue
+			}
+			err := dm.LocationPrefixSearch.AddWithPriority(location, dconf.Target, priority)
 			if err != nil {
-				errs = append(errs, dm.newCompileError(location, err))
+				errs = append(errs, dm.newCompileError(CompileErrorPrefix, location, dconf.locationPos(i), err))
+				continue
 			}
+			dm.targets.add(dconf.Target, location)
 		}
 
 	}
-	return errs
+
+	return append(errs, dm.addRewrites(dconf)...)
 }
 
-func (dm *DomainRouter) GetTargetsForPath(path string, getAll bool) ([]*Target, bool) {
-	targets := make([]*Target, 0, 1)
-	//首先寻求精确匹配
-	tlist, present := dm.LocationExactSearch[path]
-	if present && len(tlist) > 0 {
-		if !getAll {
-			targets = append(targets, &Target{
-				Value: tlist[0],
-			})
-			return targets, true
+func exactPattern(location string) string {
+	return pathConfTypeEqual + " " + location
+}
+
+func regexPattern(expr string) string {
+	return pathConfTypeRegex + " " + expr
+}
+
+//eachRegexMatch calls fn with every regex location matching path in configuration order until fn returns false.
+func (dm *DomainRouter) eachRegexMatch(path string, fn func(*RegexTarget) bool) {
+	if rm := dm.matcher(); rm != nil {
+		rm.eachMatch(path, fn)
+		return
+	}
+	for _, regexTar := range dm.regexOrder {
+		if regexTar.RegexExp.MatchString(path) && !fn(regexTar) {
+			return
 		}
-		for _, t := range tlist {
-			targets = append(targets, &Target{
-				Value: t,
-			})
+	}
+}
+
+func (dm *DomainRouter) GetTargetsForPath(path string, getAll bool) ([]*Target, bool) {
+	if !getAll {
+		target, matched := dm.getTarget(path)
+		if !matched {
+			return make([]*Target, 0, 0), false
 		}
+		return []*Target{target}, true
 	}
 
+	targets := make([]*Target, 0, 1)
+	//首先寻求精确匹配
+	targets = append(targets, dm.exactTargets[path]...)
+
 	//前缀匹配
-	pathBytes := []byte(path)
 	if dm.LocationPrefixSearch.Size > 0 {
-		candidates := dm.LocationPrefixSearch.GetCandidateLeafs(path)
-		if len(candidates) > 0 {
-			for _, candidate := range candidates {
-				targets = append(targets, &Target{
-					Value: candidate.Value,
-					Variables: candidate.Variables,
-				})
-			}
-			if !getAll {
-				return targets, true
-			}
+		for _, candidate := range dm.LocationPrefixSearch.GetCandidateLeafs(path) {
+			targets = append(targets, (*Target)(candidate))
 		}
 	}
 
-	for _, regexTar := range dm.LocationRegexSearch {
-		match := regexTar.RegexExp.Find(pathBytes)
-		if match != nil {
-			for _, t := range regexTar.Targets {
-				targets = append(targets, &Target{
-					Value: t,
-				})
-			}
-			if !getAll {
-				return targets, true
-			}
-		}
-	}
+	dm.eachRegexMatch(path, func(regexTar *RegexTarget) bool {
+		targets = append(targets, regexTar.targets...)
+		return true
+	})
 	return targets, len(targets) > 0
 }
 
+//getTarget returns the first target of GetTargetsForPath(path, false).
+//Exact, static prefix and regex hits are served from prebuilt targets without heap allocation.
+func (dm *DomainRouter) getTarget(path string) (*Target, bool) {
+	if tlist := dm.exactTargets[path]; len(tlist) > 0 {
+		return tlist[0], true
+	}
+
+	if dm.LocationPrefixSearch.Size > 0 {
+		var buf [4]*pathtree.TargetCandidate
+		candidates := dm.LocationPrefixSearch.AppendCandidateLeafs(buf[:0], path)
+		if len(candidates) > 0 {
+			return (*Target)(candidates[0]), true
+		}
+	}
+
+	var target *Target
+	dm.eachRegexMatch(path, func(regexTar *RegexTarget) bool {
+		target = regexTar.targets[0]
+		return false
+	})
+	return target, target != nil
+}
 
-func NewRouter(locationConfs []*LocationConf) (*DomainLocationRouter, []error) {
+//NewRouter builds a router from the location configurations. The returned errors are *CompileError.
+//Unless WithStrictCompile is given, the router is built from the valid part of the configurations.
+func NewRouter(locationConfs []*LocationConf, opts ...RouterOption) (*DomainLocationRouter, []error) {
+	options := getRouterOptions(opts)
 	domainExactSearch := make(map[string]*DomainRouter)
+	routes := make(map[string]*Route)
+	defaults := make(map[int]*DomainRouter)
 
 	allErrs := make([]error, 0, 3)
 	for _, lconf := range locationConfs {
 		if len(lconf.MappingConf) == 0 || lconf.Target == nil {
 			continue
 		}
+		for _, block := range lconf.MappingConf {
+			allErrs = append(allErrs, addRoutes(routes, lconf.Target, block)...)
+			if block.DefaultServer {
+				allErrs = append(allErrs, addDefaultServer(defaults, lconf, block, options.conflict)...)
+			}
+		}
+		if options.strict && len(allErrs) > 0 {
+			return nil, allErrs
+		}
 		confs, err := GetDomainConfs(lconf)
 		if err != nil {
-			allErrs = append(allErrs, err)
+			allErrs = append(allErrs, &CompileError{Kind: CompileErrorConf, Err: err})
+			if options.strict {
+				return nil, allErrs
+			}
 			continue
 		}
 
 		for _, conf := range confs {
-			if man, existed := domainExactSearch[conf.Domain]; existed {
-				appErrs := man.AppendConf(conf)
-				allErrs = append(allErrs, appErrs...)
-			} else {
-				newMan := NewDomainRouter(conf.Domain)
-				appErrs := newMan.AppendConf(conf)
-				allErrs = append(allErrs, appErrs...)
-				domainExactSearch[conf.Domain] = newMan
+			man, existed := domainExactSearch[conf.Domain]
+			if !existed {
+				man = NewDomainRouter(conf.Domain)
+				man.conflict = options.conflict
+				domainExactSearch[conf.Domain] = man
+			}
+			allErrs = append(allErrs, man.AppendConf(conf)...)
+			if options.strict && len(allErrs) > 0 {
+				return nil, allErrs
 			}
 		}
 	}
@@ -184,119 +317,142 @@ func NewRouter(locationConfs []*LocationConf) (*DomainLocationRouter, []error) {
 		DomainExactSearch:   domainExactSearch,
 		DomainPostfixSearch: pathtree.NewPathTree(),
 		DomainPrefixSearch:  pathtree.NewPathTree(),
+		routes:              routes,
+		defaultServers:      defaults,
+		policy:              options.policy,
 	}
 
-	for domain, man := range domainExactSearch {
-		domainBytes := []byte(domain)
+	//in domain order, so that a wildcard domain precedes the domain sharing its key in the postfix search
+	domains := make([]string, 0, len(domainExactSearch))
+	for domain := range domainExactSearch {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	for _, domain := range domains {
+		man := domainExactSearch[domain]
 		pErr := ins.DomainPrefixSearch.Add(domain, man)
 		if pErr != nil {
-			allErrs = append(allErrs, pErr)
+			allErrs = append(allErrs, &CompileError{Kind: CompileErrorDomainIndex, Domain: domain, Err: pErr})
 		}
 
-		domainBytesRev := GetReversedBytes(domainBytes)
-		rpErr := ins.DomainPostfixSearch.Add(string(domainBytesRev), man)
+		rpErr := ins.DomainPostfixSearch.Add(GetReversedLabels(domain), man)
 		if rpErr != nil {
-			allErrs = append(allErrs, rpErr)
+			allErrs = append(allErrs, &CompileError{Kind: CompileErrorDomainIndex, Domain: domain, Err: rpErr})
+		}
+		if options.strict && len(allErrs) > 0 {
+			return nil, allErrs
 		}
 	}
 
 	return ins, allErrs
 }
 
-//Iterator Pattern using Closure
-func (m *DomainLocationRouter) getDomainManagerIterator(domain string) func() (*DomainRouter, bool) {
-	currentStage := 0
-	stageIdx := 0
-	stageCandidates := make([]*DomainRouter, 0, 2)
-	iteredManagers := make(map[*DomainRouter]byte, domainSearchStageNum)
-
-	return func() (*DomainRouter, bool) {
-		GetNextInStage := func(stage int) (*DomainRouter, bool) {
-			switch stage {
-			case 0: //exact match
-				if stageIdx > 0 {
-					return nil, false
-				}
-				man, present := m.DomainExactSearch[domain]
-				stageIdx++
-				return man, present
-			case 1: //后缀反向匹配
-				if stageIdx == 0 {
-					domainBytes := []byte(domain)
-					reversedDomain := string(GetReversedBytes(domainBytes))
-					candidateTargets := m.DomainPostfixSearch.GetCandidateLeafs(reversedDomain)
-					for _, t := range candidateTargets {
-						dmm := t.Value.(*DomainRouter)
-						stageCandidates = append(stageCandidates, dmm)
-					}
-				}
-				if len(stageCandidates) <= stageIdx {
-					return nil, false
-				}
-				next := stageCandidates[stageIdx]
-				stageIdx++
-				return next, true
-			case 2: //前缀匹配
-				if stageIdx == 0 {
-					candidateTargets := m.DomainPrefixSearch.GetCandidateLeafs(domain)
-					for _, t := range candidateTargets {
-						dmm := t.Value.(*DomainRouter)
-						stageCandidates = append(stageCandidates, dmm)
-					}
-				}
-				if len(stageCandidates) <= stageIdx {
-					return nil, false
-				}
-				next := stageCandidates[stageIdx]
-				stageIdx++
-				return next, true
-			default:
-				return nil, false
+//betterLocation tells whether the location of a ranks before the one of b for BestLocation.
+func betterLocation(a, b *Target) bool {
+	ka, kb := a.Kind(), b.Kind()
+	if ka != kb {
+		return ka < kb
+	}
+	return ka == MatchPrefix && a.Matched > b.Matched
+}
+
+//eachDomainRouter calls fn with every DomainRouter matching domain and its stage until fn returns false.
+//Routers are visited once each, in the order of the exact, postfix and prefix search stages.
+//The default servers are not visited. domain is a host without port, see splitHostPort.
+func (m *DomainLocationRouter) eachDomainRouter(domain string, fn func(*DomainRouter, DomainStage) bool) {
+	var visitedBuf [8]*DomainRouter
+	visited := visitedBuf[:0]
+	visit := func(dm *DomainRouter, stage DomainStage) bool {
+		for _, v := range visited {
+			if v == dm {
+				return true
 			}
 		}
+		visited = append(visited, dm)
+		return fn(dm, stage)
+	}
 
-		if currentStage >= domainSearchStageNum {
-			return nil, false
-		}
+	//exact match
+	if dm, present := m.DomainExactSearch[domain]; present && !visit(dm, StageExact) {
+		return
+	}
 
-		var man *DomainRouter
-		ok := false
-		for man, ok = GetNextInStage(currentStage); currentStage < domainSearchStageNum; man, ok = GetNextInStage(currentStage) {
-			if !ok {
-				//upgrade stage
-				currentStage++
-				stageCandidates = make([]*DomainRouter, 0, 0)
-				stageIdx = 0
-			} else if _, itered := iteredManagers[man]; itered {
-				continue
-			} else {
-				iteredManagers[man] = 1
-				return man, ok
-			}
+	var candBuf [8]*pathtree.TargetCandidate
+	//后缀匹配：按标签反转后前缀匹配，反转到栈上的缓冲区
+	var labelBuf [256]byte
+	reversedDomain := appendReversedLabels(labelBuf[:0], domain)
+	for _, t := range m.DomainPostfixSearch.AppendPrefixLeafs(candBuf[:0], reversedDomain) {
+		dm := t.Value.(*DomainRouter)
+		if len(t.Pattern) == len(reversedDomain) && strings.HasPrefix(dm.Domain, ".") {
+			continue //a wildcard domain matches its subdomains only
+		}
+		if !visit(dm, StagePostfix) {
+			return
+		}
+	}
+	//前缀匹配
+	for _, t := range m.DomainPrefixSearch.AppendCandidateLeafs(candBuf[:0], domain) {
+		if !visit(t.Value.(*DomainRouter), StagePrefix) {
+			return
 		}
-		return nil, false
 	}
 }
 
-
+//GetTarget returns the first target matching domain and path. A hit on an exactly configured domain
+//with an exact or a static prefix location performs no heap allocation.
 func (m *DomainLocationRouter) GetTarget(domain string, path string) (*Target, bool) {
-	dmanIterator := m.getDomainManagerIterator(domain)
+	_, target, found := m.Lookup(domain, path)
+	return target, found
+}
 
-	for dm, present := dmanIterator(); present; dm, present = dmanIterator() {
-		targets, matched := dm.GetTargetsForPath(path, false)
-		if matched {
-			return targets[0], true
+//Lookup is GetTarget which also returns the DomainRouter whose location matched.
+func (m *DomainLocationRouter) Lookup(domain string, path string) (matched *DomainRouter, target *Target, found bool) {
+	matched, _, target, found = m.lookup(domain, path)
+	return matched, target, found
+}
+
+//lookup searches the domain routers of the host of domain as the policy of the router says,
+//then the default server of its port.
+func (m *DomainLocationRouter) lookup(domain string, path string) (matched *DomainRouter, stage DomainStage, target *Target, found bool) {
+	return m.lookupTried(domain, path, nil)
+}
+
+//lookupTried is lookup calling tried, if not nil, with every router tried and whether a location of it matched the path.
+func (m *DomainLocationRouter) lookupTried(domain string, path string, tried func(dm *DomainRouter, stage DomainStage, hit bool)) (matched *DomainRouter, stage DomainStage, target *Target, found bool) {
+	try := func(dm *DomainRouter, s DomainStage) bool {
+		t, ok := dm.getTarget(path)
+		if tried != nil {
+			tried(dm, s, ok)
+		}
+		if ok && (!found || betterLocation(t, target)) {
+			matched, stage, target, found = dm, s, t, true
 		}
+		return !found || m.policy == BestLocation
 	}
-	return nil, false
+	host, port := splitHostPort(domain)
+	m.eachDomainRouter(host, try)
+	if !found {
+		if dm := m.defaultServer(port); dm != nil {
+			try(dm, StageDefault)
+		}
+	}
+	return matched, stage, target, found
 }
 
+//GetRouterInfosOfDomain returns the routers matching the host of domain, or the default server of its port
+//if none does.
 func (m *DomainLocationRouter) GetRouterInfosOfDomain(domain string) ([]*DomainRouter, bool) {
 	routers := make([]*DomainRouter, 0, 1)
 
-	dmanIter := m.getDomainManagerIterator(domain)
-	for dm, present := dmanIter(); present; dm, present = dmanIter() {
+	host, port := splitHostPort(domain)
+	m.eachDomainRouter(host, func(dm *DomainRouter, _ DomainStage) bool {
 		routers = append(routers, dm)
+		return true
+	})
+	if len(routers) == 0 {
+		if dm := m.defaultServer(port); dm != nil {
+			routers = append(routers, dm)
+		}
 	}
 	return routers, len(routers) > 0
 }
@@ -310,15 +466,40 @@ func (m *DomainLocationRouter) GetAllRouterInfos() []*DomainRouter {
 	return routers
 }
 
+//DomainsUnder returns the domain routers of domain and of its subdomains, wildcard domains included,
+//ordered by domain.
+func (m *DomainLocationRouter) DomainsUnder(domain string) []*DomainRouter {
+	key := GetReversedLabels(domain)
+	routers := make([]*DomainRouter, 0, 4)
+	m.DomainPostfixSearch.Walk(func(pattern string, values []interface{}) bool {
+		if strings.HasPrefix(pattern, key) {
+			for _, value := range values {
+				routers = append(routers, value.(*DomainRouter))
+			}
+		}
+		return true
+	})
+	sort.Slice(routers, func(i, j int) bool {
+		return routers[i].Domain < routers[j].Domain
+	})
+	return routers
+}
+
 func (m *DomainLocationRouter) GetAllTargets(domain string, path string) ([]*Target, bool) {
-	dmanIterator := m.getDomainManagerIterator(domain)
 	targets := make([]*Target, 0, 2)
 
-	for dm, present := dmanIterator(); present; dm, present = dmanIterator() {
+	host, port := splitHostPort(domain)
+	m.eachDomainRouter(host, func(dm *DomainRouter, _ DomainStage) bool {
 		tars, matched := dm.GetTargetsForPath(path, true)
 		if matched {
 			targets = append(targets, tars...)
 		}
+		return true
+	})
+	if len(targets) == 0 {
+		if dm := m.defaultServer(port); dm != nil {
+			targets, _ = dm.GetTargetsForPath(path, true)
+		}
 	}
 
 	//remove duplicates
@@ -154,10 +154,15 @@ func TestGetTarget(t *testing.T) {
 		t.Errorf("get target error. expected: %v %v; got: %v %v", true, 2, exist, target)
 	}
 
-	target, exist = sm.GetTarget("api-hotsoon.byted.org", "/api/hotsoon/video/comment/avbasdfaskdfsdf/12345")
+	target, exist = sm.GetTarget("api.hotsoon.byted.org", "/api/hotsoon/video/comment/avbasdfaskdfsdf/12345")
 	if !exist || target.Value != 1 {
 		t.Errorf("get target error. expected: %v %v; got: %v %v", true, 1, exist, target)
 	}
+	//not a subdomain of hotsoon.byted.org
+	target, exist = sm.GetTarget("api-hotsoon.byted.org", "/api/hotsoon/video/comment/avbasdfaskdfsdf/12345")
+	if exist {
+		t.Errorf("get target error. expected: %v; got: %v %v", false, exist, target)
+	}
 
 	target, exist = sm.GetTarget("api.neihan.com", "/api/neihan/post/comment/123445/sdfjklHUIIHJFEewfsdfSDSDF")
 	if !exist || target.Value != 2 {
@@ -205,8 +210,126 @@ func TestGetTarget(t *testing.T) {
 	}
 }
 
+func TestDomainPolicy(t *testing.T) {
+	confs := []*LocationConf{
+		{Target: "exact domain", MappingConf: []*MappingBlock{{Domains: []string{"api.shop.com"}, Locations: []string{"/", "~ ^/static/"}}}},
+		{Target: "postfix domain", MappingConf: []*MappingBlock{{Domains: []string{".shop.com"}, Locations: []string{"/v1/users/", "= /health"}}}},
+	}
+	requests := []struct {
+		path              string
+		first, bestTarget string
+	}{
+		{"/v1/users/1", "exact domain", "postfix domain"},
+		{"/health", "exact domain", "postfix domain"},
+		{"/static/a.css", "exact domain", "exact domain"},
+		{"/v2", "exact domain", "exact domain"},
+	}
+
+	first, _ := NewRouter(confs)
+	best, _ := NewRouter(confs, WithDomainPolicy(BestLocation))
+	for _, req := range requests {
+		if target, _ := first.GetTarget("api.shop.com", req.path); target.Value != req.first {
+			t.Errorf("domain-first target of %s expected: %s; got: %v", req.path, req.first, target.Value)
+		}
+		if target, _ := best.GetTarget("api.shop.com", req.path); target.Value != req.bestTarget {
+			t.Errorf("best-location target of %s expected: %s; got: %v", req.path, req.bestTarget, target.Value)
+		}
+		if e := best.Explain("api.shop.com", req.path); e.Target.Value != req.bestTarget || len(e.Steps) != 2 {
+			t.Errorf("best-location explanation of %s expected: %s; got: %s", req.path, req.bestTarget, e)
+		}
+	}
+
+	data, _ := best.MarshalBinary()
+	loaded := &DomainLocationRouter{}
+	if err := loaded.UnmarshalBinary(data); err != nil || loaded.policy != BestLocation {
+		t.Errorf("loaded policy expected: %v; got: %v, %v", BestLocation, loaded.policy, err)
+	}
+}
+
+func TestBestLocationMatchedLength(t *testing.T) {
+	best, errs := NewRouter([]*LocationConf{
+		{Target: "user", MappingConf: []*MappingBlock{{Domains: []string{".example.com"}, Locations: []string{"/api/:identifier_of_the_user"}}}},
+		{Target: "users", MappingConf: []*MappingBlock{{Domains: []string{"example.com"}, Locations: []string{"/api/v1/users/"}}}},
+	}, WithDomainPolicy(BestLocation))
+	if len(errs) > 0 {
+		t.Fatalf("NewRouter errors: %v", errs)
+	}
+	requests := map[string]string{
+		"/api/v1/users/5": "users", //matches 14 bytes of the path against 7
+		"/api/v1":         "user",
+	}
+	for path, expected := range requests {
+		if target, found := best.GetTarget("www.example.com", path); !found || target.Value != expected {
+			t.Errorf("best-location target of %s expected: %s; got: %v", path, expected, target)
+		}
+		if e := best.Explain("www.example.com", path); e.Target == nil || e.Target.Value != expected {
+			t.Errorf("best-location explanation of %s expected: %s; got: %s", path, expected, e)
+		}
+	}
+}
+
+func TestGetTargetAllocs(t *testing.T) {
+	sm := getMappingManager()
+
+	cases := []struct {
+		domain, path string
+		value        interface{}
+	}{
+		{"products.byted.org", "/api/account/info", 1},
+		{"products.byted.org", "/page/post/sdfsdfweruFHUIER/1", 2},
+		{"api.hotsoon.com", "/admin/accounts/delete", 1},
+	}
+	for _, c := range cases {
+		allocs := testing.AllocsPerRun(100, func() {
+			target, exist := sm.GetTarget(c.domain, c.path)
+			if !exist || target.Value != c.value {
+				t.Fatalf("get target error. expected: %v; got: %v %v", c.value, exist, target)
+			}
+		})
+		if allocs != 0 {
+			t.Errorf("GetTarget(%s, %s) allocs expected: 0; got: %v", c.domain, c.path, allocs)
+		}
+	}
+
+	//the postfix stage reverses the labels of the domain into a stack buffer
+	confs := []*LocationConf{
+		{Target: "shop", MappingConf: []*MappingBlock{{Domains: []string{"shop.com"}, Locations: []string{"/"}}}},
+		{Target: "wildcard", MappingConf: []*MappingBlock{{Domains: []string{".shop.com"}, Locations: []string{"/cart/"}}}},
+	}
+	for _, policy := range []DomainPolicy{DomainFirst, BestLocation} {
+		router, errs := NewRouter(confs, WithDomainPolicy(policy))
+		if len(errs) > 0 {
+			t.Fatalf("NewRouter errors: %v", errs)
+		}
+		for _, c := range []struct{ domain, value string }{{"www.shop.com", "wildcard"}, {"shop.com", "shop"}} {
+			allocs := testing.AllocsPerRun(100, func() {
+				target, exist := router.GetTarget(c.domain, "/cart/1")
+				if !exist || target.Value != c.value {
+					t.Fatalf("get target error. expected: %v; got: %v %v", c.value, exist, target)
+				}
+			})
+			if allocs != 0 {
+				t.Errorf("GetTarget(%s, /cart/1) with %v allocs expected: 0; got: %v", c.domain, policy, allocs)
+			}
+		}
+	}
+}
+
+//Baselines with -benchmem before the allocation free lookup:
+//	BenchmarkGetSceneRegex    2171 ns/op  208 B/op   8 allocs/op
+//	BenchmarkGetScenePrefix    817 ns/op  248 B/op  11 allocs/op
+//	BenchmarkGetSceneMissed   3887 ns/op  608 B/op  28 allocs/op
+func BenchmarkGetSceneExact(b *testing.B) {
+	sm := getMappingManager()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sm.GetTarget("products.byted.org", "/api/account/info")
+	}
+}
+
 func BenchmarkGetSceneRegex(b *testing.B) {
 	sm := getMappingManager()
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		sm.GetTarget("api.neihan.com", "/api/neihan/post/comment/123445/sdfjklHUIIHJFEewfsdfSDSDF")
 	}
@@ -214,6 +337,7 @@ func BenchmarkGetSceneRegex(b *testing.B) {
 
 func BenchmarkGetScenePrefix(b *testing.B) {
 	sm := getMappingManager()
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		sm.GetTarget("products.byted.org", "/page/post/sdfsdfweruFHUIER/1")
 	}
@@ -221,7 +345,56 @@ func BenchmarkGetScenePrefix(b *testing.B) {
 
 func BenchmarkGetSceneMissed(b *testing.B) {
 	sm := getMappingManager()
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		sm.GetTarget("products.byted.org", "/page/postit/sdfsdfweruFHUIER/1")
 	}
 }
+
+func TestPostfixLabels(t *testing.T) {
+	if reversed := GetReversedLabels("api.example.com"); reversed != "com.example.api." {
+		t.Errorf("reversed labels expected: com.example.api.; got: %s", reversed)
+	}
+	router, errs := NewRouter([]*LocationConf{
+		{Target: "shop", MappingConf: []*MappingBlock{{Domains: []string{"shop.com"}, Locations: []string{"/"}}}},
+		{Target: "wildcard", MappingConf: []*MappingBlock{{Domains: []string{".shop.com"}, Locations: []string{"/sub/"}}}},
+		{Target: "api", MappingConf: []*MappingBlock{{Domains: []string{"api.shop.com", "myshop.com"}, Locations: []string{"/api/"}}}},
+	})
+	if len(errs) > 0 {
+		t.Fatalf("NewRouter errors: %v", errs)
+	}
+	requests := []struct {
+		domain, path string
+		target       interface{}
+	}{
+		{"shop.com", "/sub/1", "shop"},
+		{"www.shop.com", "/sub/1", "wildcard"},
+		{"a.b.shop.com", "/x", "shop"},
+		{"v1.api.shop.com", "/api/x", "api"},
+		{"xshop.com", "/x", nil},
+	}
+	for _, req := range requests {
+		target, found := router.GetTarget(req.domain, req.path)
+		if req.target == nil && found || req.target != nil && (!found || target.Value != req.target) {
+			t.Errorf("target of %s%s expected: %v; got: %v", req.domain, req.path, req.target, target)
+		}
+	}
+
+	domains := make([]string, 0, 3)
+	for _, dm := range router.DomainsUnder("shop.com") {
+		domains = append(domains, dm.Domain)
+	}
+	if fmt.Sprint(domains) != "[.shop.com api.shop.com shop.com]" {
+		t.Errorf("domains under shop.com expected: [.shop.com api.shop.com shop.com]; got: %v", domains)
+	}
+
+	//the postfix search is restored from snapshots
+	data, _ := router.MarshalBinary()
+	loaded := &DomainLocationRouter{}
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary error: %v", err)
+	}
+	if target, _ := loaded.GetTarget("www.shop.com", "/sub/1"); target == nil || target.Value != "wildcard" {
+		t.Errorf("target of the loaded router expected: wildcard; got: %v", target)
+	}
+}
@@ -0,0 +1,166 @@
+package dlrouter
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var (
+	RouteLocationErr  = errors.New("[dlrouter compile] the named location is not a location of the block")
+	RouteRegexErr     = errors.New("[dlrouter compile] regex locations can not be named")
+	RouteDomainErr    = errors.New("[dlrouter compile] no domain of the block is a host to build URLs with")
+	DuplicateRouteErr = errors.New("[dlrouter compile] the route name is used by another location")
+
+	RouteNotFoundErr   = errors.New("[dlrouter url] route not found")
+	MissingVariableErr = errors.New("[dlrouter url] missing path variable")
+	InvalidVariableErr = errors.New("[dlrouter url] invalid path variable")
+)
+
+//Route is a named location, from which URLs are built.
+type Route struct {
+	Name     string      `json:"name"`
+	Domain   string      `json:"domain"`   //the canonical domain: the first domain of the block which is a host, not a domain pattern
+	Location string      `json:"location"` //"= exact" or "prefix", as the Pattern of its Targets
+	Target   interface{} `json:"target"`
+}
+
+//canonicalDomain returns the first domain which neither starts nor ends with '.'.
+func canonicalDomain(domains []string) (string, bool) {
+	for _, domain := range domains {
+		if len(domain) > 0 && domain[0] != '.' && domain[len(domain)-1] != '.' {
+			return domain, true
+		}
+	}
+	return "", false
+}
+
+//normalizeLocation returns the pattern of a location as matched by the routers.
+func normalizeLocation(location string) string {
+	location = strings.TrimSpace(location)
+	if strings.Index(location, "= ") == 0 {
+		return exactPattern(strings.TrimSpace(location[2:]))
+	}
+	if strings.Index(location, "~ ") == 0 {
+		return regexPattern(strings.TrimSpace(location[2:]))
+	}
+	return location
+}
+
+//addRoutes adds the named locations of a block to routes. The returned errors are *CompileError.
+func addRoutes(routes map[string]*Route, target interface{}, block *MappingBlock) []error {
+	if len(block.Names) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(block.Names))
+	for name := range block.Names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := make([]error, 0, 1)
+	domain, hasHost := canonicalDomain(block.Domains)
+	for _, name := range names {
+		location := normalizeLocation(block.Names[name])
+		newErr := func(err error) error {
+			return &CompileError{Kind: CompileErrorRoute, Domain: domain, Location: location, Pos: block.Pos, Err: fmt.Errorf("%w: %s", err, name)}
+		}
+
+		found := false
+		for _, l := range block.Locations {
+			if normalizeLocation(l) == location {
+				found = true
+				break
+			}
+		}
+		switch {
+		case !found:
+			errs = append(errs, newErr(RouteLocationErr))
+			continue
+		case patternKind(location) == MatchRegex:
+			errs = append(errs, newErr(RouteRegexErr))
+			continue
+		case !hasHost:
+			errs = append(errs, newErr(RouteDomainErr))
+			continue
+		}
+
+		if route, present := routes[name]; present {
+			if route.Location != location {
+				errs = append(errs, newErr(DuplicateRouteErr))
+			}
+			continue
+		}
+		routes[name] = &Route{Name: name, Domain: domain, Location: location, Target: target}
+	}
+	return errs
+}
+
+//Route returns the route of name.
+func (m *DomainLocationRouter) Route(name string) (*Route, bool) {
+	route, present := m.routes[name]
+	return route, present
+}
+
+//Routes returns the routes ordered by name.
+func (m *DomainLocationRouter) Routes() []*Route {
+	routes := make([]*Route, 0, len(m.routes))
+	for _, route := range m.routes {
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].Name < routes[j].Name
+	})
+	return routes
+}
+
+//URL builds the URL of the route name on its canonical domain, filling the path variables of its location
+//with vars. Variables can neither be empty nor contain '/'. The scheme of the URL is left to the caller.
+func (m *DomainLocationRouter) URL(name string, vars map[string]string) (*url.URL, error) {
+	route, present := m.routes[name]
+	if !present {
+		return nil, fmt.Errorf("%w: %s", RouteNotFoundErr, name)
+	}
+	path, err := route.Path(vars)
+	if err != nil {
+		return nil, err
+	}
+	return &url.URL{Host: route.Domain, Path: path}, nil
+}
+
+//Path returns the path of the route with its variables filled with vars.
+func (r *Route) Path(vars map[string]string) (string, error) {
+	if patternKind(r.Location) == MatchExact {
+		return r.Location[len(pathConfTypeEqual)+1:], nil
+	}
+
+	var path strings.Builder
+	pattern := r.Location
+	for {
+		pos := strings.IndexByte(pattern, ':')
+		if pos < 0 {
+			path.WriteString(pattern)
+			return path.String(), nil
+		}
+		path.WriteString(pattern[:pos])
+		pattern = pattern[pos+1:]
+
+		end := strings.IndexByte(pattern, '/')
+		if end < 0 {
+			end = len(pattern)
+		}
+		varName := pattern[:end]
+		pattern = pattern[end:]
+
+		value, present := vars[varName]
+		if !present {
+			return "", fmt.Errorf("%w: %s of route %s", MissingVariableErr, varName, r.Name)
+		}
+		if len(value) == 0 || strings.IndexByte(value, '/') >= 0 {
+			return "", fmt.Errorf("%w: %s=%q of route %s", InvalidVariableErr, varName, value, r.Name)
+		}
+		path.WriteString(value)
+	}
+}
@@ -0,0 +1,101 @@
+package dlrouter
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func getRoutesRouter(t *testing.T) *DomainLocationRouter {
+	router, errs := NewRouter([]*LocationConf{{
+		Target: "users",
+		MappingConf: []*MappingBlock{{
+			Domains:   []string{".example.com", "www.example.com", "example.com"},
+			Locations: []string{"/users/:id/posts/:post", "= /users", "~ ^/u/[0-9]+$"},
+			Names: map[string]string{
+				"post":  "/users/:id/posts/:post",
+				"users": "=   /users",
+			},
+		}},
+	}})
+	if len(errs) > 0 {
+		t.Fatalf("NewRouter errors: %v", errs)
+	}
+	return router
+}
+
+func TestURL(t *testing.T) {
+	router := getRoutesRouter(t)
+
+	u, err := router.URL("post", map[string]string{"id": "42", "post": "hello world", "unused": "x"})
+	if err != nil || u.String() != "//www.example.com/users/42/posts/hello%20world" {
+		t.Errorf("url expected: //www.example.com/users/42/posts/hello%%20world; got: %v, %v", u, err)
+	}
+	if u, err = router.URL("users", nil); err != nil || u.String() != "//www.example.com/users" {
+		t.Errorf("url expected: //www.example.com/users; got: %v, %v", u, err)
+	}
+
+	if _, err = router.URL("none", nil); !errors.Is(err, RouteNotFoundErr) {
+		t.Errorf("error expected: %v; got: %v", RouteNotFoundErr, err)
+	}
+	if _, err = router.URL("post", map[string]string{"id": "42"}); !errors.Is(err, MissingVariableErr) {
+		t.Errorf("error expected: %v; got: %v", MissingVariableErr, err)
+	}
+	if _, err = router.URL("post", map[string]string{"id": "4/2", "post": "p"}); !errors.Is(err, InvalidVariableErr) {
+		t.Errorf("error expected: %v; got: %v", InvalidVariableErr, err)
+	}
+}
+
+func TestRouteCompileErrors(t *testing.T) {
+	_, errs := NewRouter([]*LocationConf{
+		{
+			Target: 1,
+			MappingConf: []*MappingBlock{{
+				Domains:   []string{"a.com"},
+				Locations: []string{"/a", "~ ^/b"},
+				Names:     map[string]string{"a": "/a", "b": "~ ^/b", "c": "/c"},
+			}},
+		},
+		{
+			Target: 2,
+			MappingConf: []*MappingBlock{
+				{Domains: []string{"b.com"}, Locations: []string{"/x"}, Names: map[string]string{"a": "/x"}},
+				{Domains: []string{".c.com"}, Locations: []string{"/y"}, Names: map[string]string{"y": "/y"}},
+			},
+		},
+	})
+	expected := []error{RouteRegexErr, RouteLocationErr, DuplicateRouteErr, RouteDomainErr}
+	if len(errs) != len(expected) {
+		t.Fatalf("errors expected: %v; got: %v", expected, errs)
+	}
+	for i, err := range errs {
+		var compileErr *CompileError
+		if !errors.As(err, &compileErr) || compileErr.Kind != CompileErrorRoute || !errors.Is(err, expected[i]) {
+			t.Errorf("route compile error expected: %v; got: %v", expected[i], err)
+		}
+	}
+}
+
+func TestRoutesRoundTrip(t *testing.T) {
+	router := getRoutesRouter(t)
+
+	exported, errs := NewRouter(router.ExportConfs())
+	if len(errs) > 0 {
+		t.Fatalf("rebuild errors: %v", errs)
+	}
+	if !reflect.DeepEqual(exported.Routes(), router.Routes()) {
+		t.Errorf("exported routes expected: %v; got: %v", router.Routes(), exported.Routes())
+	}
+
+	data, err := router.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary error: %v", err)
+	}
+	loaded := &DomainLocationRouter{}
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary error: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Routes(), router.Routes()) {
+		t.Errorf("loaded routes expected: %v; got: %v", router.Routes(), loaded.Routes())
+	}
+}
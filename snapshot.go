@@ -0,0 +1,471 @@
+package dlrouter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/conndots/dlrouter/pathtree"
+)
+
+const (
+	//SnapshotVersion is the format version written by MarshalBinary. Snapshots of other versions are rejected.
+	SnapshotVersion = 1
+
+	snapshotMagic     = "DLRS"
+	snapshotHeaderLen = 4 + 4 + 4 + 8 //magic, version, crc32 of the payload, payload length
+)
+
+var (
+	SnapshotFormatErr   = errors.New("[dlrouter snapshot] not a router snapshot or truncated")
+	SnapshotVersionErr  = errors.New("[dlrouter snapshot] unsupported snapshot format version")
+	SnapshotChecksumErr = errors.New("[dlrouter snapshot] snapshot checksum mismatch")
+
+	snapshotCrcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+//TargetCodec encodes the opaque target values of a router into a snapshot and decodes them back.
+//DecodeTarget must not retain data.
+type TargetCodec interface {
+	EncodeTarget(target interface{}) ([]byte, error)
+	DecodeTarget(data []byte) (interface{}, error)
+}
+
+//GobTargetCodec is the TargetCodec used when the router has none.
+//Target types other than the predeclared ones have to be registered with gob.Register.
+type GobTargetCodec struct{}
+
+type gobTarget struct {
+	Value interface{}
+}
+
+func (GobTargetCodec) EncodeTarget(target interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(&gobTarget{Value: target})
+	return buf.Bytes(), err
+}
+
+func (GobTargetCodec) DecodeTarget(data []byte) (interface{}, error) {
+	var t gobTarget
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&t)
+	return t.Value, err
+}
+
+func (m *DomainLocationRouter) targetCodec() TargetCodec {
+	if m.TargetCodec == nil {
+		return GobTargetCodec{}
+	}
+	return m.TargetCodec
+}
+
+//appendTargetIDs appends the ids of the targets of a location and their priorities.
+func appendTargetIDs(buf []byte, targets *targetSet, values []interface{}, priorities []int) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(values)))
+	for i, t := range values {
+		buf = binary.AppendUvarint(buf, uint64(targets.id(t)))
+		buf = binary.AppendVarint(buf, int64(priorities[i]))
+	}
+	return buf
+}
+
+//appendDomainRouter appends the domain, the conflict policy, the locations and the rewrite rules of a domain router.
+func appendDomainRouter(buf []byte, dm *DomainRouter, table *targetSet) ([]byte, error) {
+	buf = appendSnapshotString(buf, dm.Domain)
+	buf = append(buf, byte(dm.conflict))
+	locations := make([]string, 0, len(dm.LocationExactSearch))
+	for location := range dm.LocationExactSearch {
+		locations = append(locations, location)
+	}
+	sort.Strings(locations)
+	buf = binary.AppendUvarint(buf, uint64(len(locations)))
+	for _, location := range locations {
+		buf = appendSnapshotString(buf, location)
+		tlist := dm.LocationExactSearch[location]
+		buf = appendTargetIDs(buf, table, tlist, dm.locationPriorities(exactPattern(location), len(tlist)))
+	}
+
+	var err error
+	buf, err = dm.LocationPrefixSearch.AppendBinary(buf, func(value interface{}) (uint64, error) {
+		return uint64(table.id(value)), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(dm.regexOrder)))
+	for _, regexTar := range dm.regexOrder {
+		buf = appendSnapshotString(buf, regexTar.RegexExp.String())
+		pattern := regexPattern(regexTar.RegexExp.String())
+		buf = appendTargetIDs(buf, table, regexTar.Targets, dm.locationPriorities(pattern, len(regexTar.Targets)))
+	}
+
+	rules := dm.rewriteRules()
+	buf = binary.AppendUvarint(buf, uint64(len(rules)))
+	for _, rule := range rules {
+		buf = appendSnapshotString(buf, rule.conf.Location)
+		buf = appendSnapshotString(buf, rule.conf.Regex)
+		buf = appendSnapshotString(buf, rule.conf.Replacement)
+		buf = appendSnapshotString(buf, rule.conf.Flag)
+		buf = binary.AppendUvarint(buf, uint64(table.id(rule.target)))
+	}
+	return buf, nil
+}
+
+//MarshalBinary encodes the compiled router into a versioned snapshot, validated by a checksum on loading.
+//The targets are encoded with the router's TargetCodec. The targets of every location are encoded in their matching order,
+//with their priorities.
+func (m *DomainLocationRouter) MarshalBinary() ([]byte, error) {
+	table := newTargetSet()
+
+	domains := make([]string, 0, len(m.DomainExactSearch))
+	for domain := range m.DomainExactSearch {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	domainIDs := make(map[*DomainRouter]uint64, len(domains))
+
+	var err error
+	routers := make([]byte, 0, 256)
+	routers = binary.AppendUvarint(routers, uint64(len(domains)))
+	for i, domain := range domains {
+		dm := m.DomainExactSearch[domain]
+		domainIDs[dm] = uint64(i)
+		if routers, err = appendDomainRouter(routers, dm, table); err != nil {
+			return nil, err
+		}
+	}
+
+	domainID := func(value interface{}) (uint64, error) {
+		id, present := domainIDs[value.(*DomainRouter)]
+		if !present {
+			return 0, fmt.Errorf("[dlrouter snapshot] domain search of %s is not in the exact search", value.(*DomainRouter).Domain)
+		}
+		return id, nil
+	}
+	routers, err = m.DomainPostfixSearch.AppendBinary(routers, domainID)
+	if err != nil {
+		return nil, err
+	}
+	routers, err = m.DomainPrefixSearch.AppendBinary(routers, domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := m.Routes()
+	routers = binary.AppendUvarint(routers, uint64(len(routes)))
+	for _, route := range routes {
+		routers = appendSnapshotString(routers, route.Name)
+		routers = appendSnapshotString(routers, route.Domain)
+		routers = appendSnapshotString(routers, route.Location)
+		routers = binary.AppendUvarint(routers, uint64(table.id(route.Target)))
+	}
+
+	defaults := m.DefaultServers()
+	routers = binary.AppendUvarint(routers, uint64(len(defaults)))
+	for _, dm := range defaults {
+		routers = binary.AppendUvarint(routers, uint64(m.defaultPort(dm)))
+		if routers, err = appendDomainRouter(routers, dm, table); err != nil {
+			return nil, err
+		}
+	}
+	routers = append(routers, byte(m.policy))
+
+	codec := m.targetCodec()
+	payload := make([]byte, 0, len(routers)+16*len(table.values)+8)
+	payload = binary.AppendUvarint(payload, uint64(len(table.values)))
+	for _, t := range table.values {
+		data, err := codec.EncodeTarget(t)
+		if err != nil {
+			return nil, fmt.Errorf("[dlrouter snapshot] encode target %v: %v", t, err)
+		}
+		payload = binary.AppendUvarint(payload, uint64(len(data)))
+		payload = append(payload, data...)
+	}
+	payload = append(payload, routers...)
+
+	snapshot := make([]byte, snapshotHeaderLen, snapshotHeaderLen+len(payload))
+	copy(snapshot, snapshotMagic)
+	binary.LittleEndian.PutUint32(snapshot[4:], SnapshotVersion)
+	binary.LittleEndian.PutUint32(snapshot[8:], crc32.Checksum(payload, snapshotCrcTable))
+	binary.LittleEndian.PutUint64(snapshot[12:], uint64(len(payload)))
+	return append(snapshot, payload...), nil
+}
+
+//UnmarshalBinary replaces the router with the one encoded in a snapshot of MarshalBinary, decoding the targets
+//with the router's TargetCodec. Regexes are compiled again, the trees are restored as they were built.
+//data is not retained, so it may be a memory-mapped file which is unmapped afterwards.
+func (m *DomainLocationRouter) UnmarshalBinary(data []byte) error {
+	if len(data) < snapshotHeaderLen || string(data[:4]) != snapshotMagic {
+		return SnapshotFormatErr
+	}
+	version := binary.LittleEndian.Uint32(data[4:])
+	if version != SnapshotVersion {
+		return fmt.Errorf("%w: got %d, expected %d", SnapshotVersionErr, version, SnapshotVersion)
+	}
+	payload := data[snapshotHeaderLen:]
+	if binary.LittleEndian.Uint64(data[12:]) != uint64(len(payload)) {
+		return SnapshotFormatErr
+	}
+	if crc32.Checksum(payload, snapshotCrcTable) != binary.LittleEndian.Uint32(data[8:]) {
+		return SnapshotChecksumErr
+	}
+
+	dec := &snapshotDecoder{data: payload}
+	codec := m.targetCodec()
+	dec.targets = make([]interface{}, dec.length())
+	for i := range dec.targets {
+		raw := dec.bytes()
+		if dec.err != nil {
+			return dec.err
+		}
+		t, err := codec.DecodeTarget(raw)
+		if err != nil {
+			return fmt.Errorf("[dlrouter snapshot] decode target: %v", err)
+		}
+		dec.targets[i] = t
+	}
+
+	domainRouters := make([]*DomainRouter, dec.length())
+	domainExactSearch := make(map[string]*DomainRouter, len(domainRouters))
+	for i := range domainRouters {
+		dm, err := dec.domainRouter()
+		if err != nil {
+			return err
+		}
+		domainRouters[i] = dm
+		domainExactSearch[dm.Domain] = dm
+	}
+	if dec.err != nil {
+		return dec.err
+	}
+
+	domainRouter := func(id uint64) (interface{}, error) {
+		if id >= uint64(len(domainRouters)) {
+			return nil, SnapshotFormatErr
+		}
+		return domainRouters[id], nil
+	}
+	postfixSearch, rest, err := pathtree.DecodeBinary(dec.data, domainRouter)
+	if err != nil {
+		return SnapshotFormatErr
+	}
+	prefixSearch, rest, err := pathtree.DecodeBinary(rest, domainRouter)
+	if err != nil {
+		return SnapshotFormatErr
+	}
+
+	dec.data = rest
+	routes := make(map[string]*Route)
+	routeNum := dec.length()
+	for i := 0; i < routeNum && dec.err == nil; i++ {
+		route := &Route{Name: dec.string(), Domain: dec.string(), Location: dec.string()}
+		if route.Target, err = dec.target(dec.uvarint()); err != nil {
+			return err
+		}
+		routes[route.Name] = route
+	}
+	defaults := make(map[int]*DomainRouter)
+	defaultNum := dec.length()
+	for i := 0; i < defaultNum && dec.err == nil; i++ {
+		port := int(dec.uvarint())
+		dm, err := dec.domainRouter()
+		if err != nil {
+			return err
+		}
+		defaults[port] = dm
+	}
+	policy := DomainPolicy(dec.byte())
+	if dec.err != nil || len(dec.data) > 0 {
+		return SnapshotFormatErr
+	}
+
+	m.DomainExactSearch = domainExactSearch
+	m.DomainPostfixSearch = postfixSearch
+	m.DomainPrefixSearch = prefixSearch
+	m.routes = routes
+	m.defaultServers = defaults
+	m.policy = policy
+	return nil
+}
+
+//WriteSnapshotFile writes the snapshot of the router to filename.
+func (m *DomainLocationRouter) WriteSnapshotFile(filename string) error {
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+//LoadSnapshotFile loads a router from a snapshot file written by WriteSnapshotFile.
+//A nil codec decodes the targets with GobTargetCodec.
+func LoadSnapshotFile(filename string, codec TargetCodec) (*DomainLocationRouter, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	router := &DomainLocationRouter{TargetCodec: codec}
+	if err := router.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return router, nil
+}
+
+func appendSnapshotString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+type snapshotDecoder struct {
+	data    []byte
+	err     error
+	targets []interface{}
+}
+
+func (dec *snapshotDecoder) target(id uint64) (interface{}, error) {
+	if id >= uint64(len(dec.targets)) {
+		return nil, SnapshotFormatErr
+	}
+	return dec.targets[id], nil
+}
+
+//targetList decodes the targets of a location of appendTargetIDs, recording their priorities for pattern.
+func (dec *snapshotDecoder) targetList(dm *DomainRouter, pattern string) []interface{} {
+	list := make([]interface{}, dec.length())
+	priorities := make([]int, len(list))
+	prioritized := false
+	for i := range list {
+		if id := dec.uvarint(); id < uint64(len(dec.targets)) {
+			list[i] = dec.targets[id]
+		} else if dec.err == nil {
+			dec.err = SnapshotFormatErr
+		}
+		priorities[i] = int(dec.varint())
+		prioritized = prioritized || priorities[i] != 0
+	}
+	if prioritized {
+		if dm.priorities == nil {
+			dm.priorities = make(map[string][]int, 4)
+		}
+		dm.priorities[pattern] = priorities
+	}
+	return list
+}
+
+//domainRouter decodes a domain router of appendDomainRouter.
+func (dec *snapshotDecoder) domainRouter() (*DomainRouter, error) {
+	dm := NewDomainRouter(dec.string())
+	dm.conflict = ConflictPolicy(dec.byte())
+	locationNum := dec.length()
+	for j := 0; j < locationNum && dec.err == nil; j++ {
+		location := dec.string()
+		tlist := dec.targetList(dm, exactPattern(location))
+		dm.LocationExactSearch[location] = tlist
+		for _, t := range tlist {
+			dm.exactTargets[location] = append(dm.exactTargets[location], &Target{Value: t, Pattern: exactPattern(location), Matched: len(location)})
+		}
+	}
+	if dec.err != nil {
+		return nil, dec.err
+	}
+
+	var err error
+	dm.LocationPrefixSearch, dec.data, err = pathtree.DecodeBinary(dec.data, dec.target)
+	if err != nil {
+		return nil, SnapshotFormatErr
+	}
+
+	regexNum := dec.length()
+	for j := 0; j < regexNum && dec.err == nil; j++ {
+		expr := dec.string()
+		regexExp, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, dm.newCompileError(CompileErrorRegex, regexPattern(expr), SourcePos{}, err)
+		}
+		regexTar := &RegexTarget{
+			RegexExp: regexExp,
+			Targets:  make([]interface{}, 0, 1),
+		}
+		for _, t := range dec.targetList(dm, regexPattern(expr)) {
+			regexTar.add(t)
+		}
+		dm.LocationRegexSearch[expr] = regexTar
+		dm.regexOrder = append(dm.regexOrder, regexTar)
+	}
+
+	ruleNum := dec.length()
+	for j := 0; j < ruleNum && dec.err == nil; j++ {
+		conf := &RewriteConf{Location: dec.string(), Regex: dec.string(), Replacement: dec.string(), Flag: dec.string()}
+		regex, err := regexp.Compile(conf.Regex)
+		if err != nil {
+			return nil, dm.newCompileError(CompileErrorRewrite, conf.Location, SourcePos{}, err)
+		}
+		t, err := dec.target(dec.uvarint())
+		if err != nil {
+			return nil, err
+		}
+		dm.addRewriteRule(&rewriteRule{conf: conf, regex: regex, target: t})
+	}
+	dm.indexTargets()
+	return dm, dec.err
+}
+
+func (dec *snapshotDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(dec.data)
+	if n <= 0 {
+		dec.err = SnapshotFormatErr
+		dec.data = nil
+		return 0
+	}
+	dec.data = dec.data[n:]
+	return v
+}
+
+func (dec *snapshotDecoder) varint() int64 {
+	v, n := binary.Varint(dec.data)
+	if n <= 0 {
+		dec.err = SnapshotFormatErr
+		dec.data = nil
+		return 0
+	}
+	dec.data = dec.data[n:]
+	return v
+}
+
+func (dec *snapshotDecoder) byte() byte {
+	if len(dec.data) == 0 {
+		dec.err = SnapshotFormatErr
+		return 0
+	}
+	b := dec.data[0]
+	dec.data = dec.data[1:]
+	return b
+}
+
+//length reads an element count, which can never exceed the remaining bytes
+func (dec *snapshotDecoder) length() int {
+	n := dec.uvarint()
+	if n > uint64(len(dec.data)) {
+		dec.err = SnapshotFormatErr
+		dec.data = nil
+		return 0
+	}
+	return int(n)
+}
+
+func (dec *snapshotDecoder) bytes() []byte {
+	n := dec.length()
+	b := dec.data[:n:n]
+	dec.data = dec.data[n:]
+	return b
+}
+
+func (dec *snapshotDecoder) string() string {
+	return string(dec.bytes())
+}
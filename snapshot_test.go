@@ -0,0 +1,131 @@
+package dlrouter
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+var snapshotRequests = [][2]string{
+	{"api.neihan.com", "/api/neihan/video/detail/123435345"},
+	{"api-hotsoon.byted.org", "/api/hotsoon/video/comment/avbasdfaskdfsdf/12345"},
+	{"products.byted.org", "/page/video/sdfsdfweruFHUIER/1"},
+	{"products.byted.org", "/page/postit/sdfsdfweruFHUIER/1"},
+	{"products.byted.org", "/common/api/"},
+	{"products.byted.org", "/info/4/group/12345/comments/"},
+	{"10.3.23.40:9009", "/wenda/web/feed/brow/"},
+	{"aweme.snssdk.com", "/aweme/v1/discover/search/"},
+}
+
+func assertSameRouting(t *testing.T, expected, got *DomainLocationRouter) {
+	for _, req := range snapshotRequests {
+		et, eok := expected.GetTarget(req[0], req[1])
+		gt, gok := got.GetTarget(req[0], req[1])
+		if eok != gok || eok && (et.Value != gt.Value || len(et.Variables) != len(gt.Variables)) {
+			t.Errorf("%s%s expected: %v %v; got: %v %v", req[0], req[1], eok, et, gok, gt)
+			continue
+		}
+		if !eok {
+			continue
+		}
+		for name, value := range et.Variables {
+			if gt.Variables[name] != value {
+				t.Errorf("%s%s variable %s expected: %s; got: %s", req[0], req[1], name, value, gt.Variables[name])
+			}
+		}
+
+		etargets, _ := expected.GetAllTargets(req[0], req[1])
+		gtargets, _ := got.GetAllTargets(req[0], req[1])
+		if len(etargets) != len(gtargets) {
+			t.Errorf("%s%s all targets expected: %v; got: %v", req[0], req[1], etargets, gtargets)
+		}
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	sm := getMappingManager()
+	data, err := sm.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+	loaded := &DomainLocationRouter{}
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	assertSameRouting(t, sm, loaded)
+
+	again, err := loaded.MarshalBinary()
+	if err != nil || string(again) != string(data) {
+		t.Errorf("snapshot of a loaded router differs. err=%v", err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "router.snapshot")
+	if err := sm.WriteSnapshotFile(filename); err != nil {
+		t.Fatalf("write snapshot file error: %v", err)
+	}
+	fromFile, err := LoadSnapshotFile(filename, nil)
+	if err != nil {
+		t.Fatalf("load snapshot file error: %v", err)
+	}
+	assertSameRouting(t, sm, fromFile)
+}
+
+type stringTargetCodec struct{}
+
+func (stringTargetCodec) EncodeTarget(target interface{}) ([]byte, error) {
+	return []byte(strconv.Itoa(target.(int))), nil
+}
+
+func (stringTargetCodec) DecodeTarget(data []byte) (interface{}, error) {
+	return strconv.Atoi(string(data))
+}
+
+func TestSnapshotTargetCodec(t *testing.T) {
+	sm := getMappingManager()
+	sm.TargetCodec = stringTargetCodec{}
+	data, err := sm.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+	loaded := &DomainLocationRouter{TargetCodec: stringTargetCodec{}}
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	assertSameRouting(t, sm, loaded)
+}
+
+func TestSnapshotValidation(t *testing.T) {
+	data, err := getMappingManager().MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+
+	corrupted := append([]byte(nil), data...)
+	corrupted[len(corrupted)-3] ^= 0xff
+	if err := new(DomainLocationRouter).UnmarshalBinary(corrupted); err != SnapshotChecksumErr {
+		t.Errorf("corrupted snapshot expected: %v; got: %v", SnapshotChecksumErr, err)
+	}
+
+	newer := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(newer[4:], SnapshotVersion+1)
+	if err := new(DomainLocationRouter).UnmarshalBinary(newer); !errors.Is(err, SnapshotVersionErr) {
+		t.Errorf("newer snapshot expected: %v; got: %v", SnapshotVersionErr, err)
+	}
+
+	if err := new(DomainLocationRouter).UnmarshalBinary(data[:len(data)-1]); err != SnapshotFormatErr {
+		t.Errorf("truncated snapshot expected: %v; got: %v", SnapshotFormatErr, err)
+	}
+
+	//a payload cut before its last byte, the domain policy, with a valid header and checksum
+	payload := data[snapshotHeaderLen : len(data)-1]
+	cut := append([]byte(nil), data[:snapshotHeaderLen]...)
+	binary.LittleEndian.PutUint32(cut[8:], crc32.Checksum(payload, snapshotCrcTable))
+	binary.LittleEndian.PutUint64(cut[12:], uint64(len(payload)))
+	cut = append(cut, payload...)
+	if err := new(DomainLocationRouter).UnmarshalBinary(cut); err != SnapshotFormatErr {
+		t.Errorf("snapshot without domain policy expected: %v; got: %v", SnapshotFormatErr, err)
+	}
+}
@@ -0,0 +1,123 @@
+package dlrouter
+
+import (
+	"sort"
+	"strings"
+)
+
+//targetIndex maps the targets of a domain router to the patterns of the locations having them, in the order
+//they were added. Targets which are not comparable are found with reflect.DeepEqual.
+type targetIndex struct {
+	index   map[interface{}]int
+	entries []*targetEntry
+}
+
+type targetEntry struct {
+	target   interface{}
+	patterns []string
+}
+
+func newTargetIndex() *targetIndex {
+	return &targetIndex{
+		index:   make(map[interface{}]int, 4),
+		entries: make([]*targetEntry, 0, 4),
+	}
+}
+
+func (ti *targetIndex) entry(target interface{}) (*targetEntry, bool) {
+	if comparableTarget(target) {
+		i, present := ti.index[target]
+		if !present {
+			return nil, false
+		}
+		return ti.entries[i], true
+	}
+	for _, e := range ti.entries {
+		if SameTarget(e.target, target) {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+//add records that the location pattern has target.
+func (ti *targetIndex) add(target interface{}, pattern string) {
+	e, present := ti.entry(target)
+	if !present {
+		e = &targetEntry{target: target, patterns: make([]string, 0, 1)}
+		if comparableTarget(target) {
+			ti.index[target] = len(ti.entries)
+		}
+		ti.entries = append(ti.entries, e)
+	}
+	for _, p := range e.patterns {
+		if p == pattern {
+			return
+		}
+	}
+	e.patterns = append(e.patterns, pattern)
+}
+
+func (ti *targetIndex) patterns(target interface{}) []string {
+	if e, present := ti.entry(target); present {
+		return e.patterns
+	}
+	return nil
+}
+
+//indexTargets rebuilds the target index from the locations of the router.
+func (dm *DomainRouter) indexTargets() {
+	dm.targets = newTargetIndex()
+	locations := locationTargets(dm)
+	patterns := make([]string, 0, len(locations))
+	for pattern := range locations {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		for _, t := range locations[pattern] {
+			dm.targets.add(t, pattern)
+		}
+	}
+}
+
+//locationValues returns the targets of the location pattern in matching order.
+func (dm *DomainRouter) locationValues(pattern string) []interface{} {
+	switch patternKind(pattern) {
+	case MatchExact:
+		return dm.LocationExactSearch[strings.TrimPrefix(pattern, pathConfTypeEqual+" ")]
+	case MatchRegex:
+		if regexTar, present := dm.LocationRegexSearch[strings.TrimPrefix(pattern, pathConfTypeRegex+" ")]; present {
+			return regexTar.Targets
+		}
+		return nil
+	default:
+		values, _ := dm.LocationPrefixSearch.PatternValues(pattern)
+		return values
+	}
+}
+
+//TargetLocations returns the patterns of the locations of the router having target, in the order they were added.
+func (dm *DomainRouter) TargetLocations(target interface{}) []string {
+	return dm.targets.patterns(target)
+}
+
+//RoutesForTarget returns every location of the domain routers, then of the default servers, which has target
+//among its targets, ordered by domain and location. The locations are looked up in an index of the targets of
+//every domain router, kept up to date by AppendConf.
+func (m *DomainLocationRouter) RoutesForTarget(target interface{}) []*LocationRef {
+	refs := make([]*LocationRef, 0, 4)
+	for _, dm := range append(m.sortedDomainRouters(), m.DefaultServers()...) {
+		patterns := append([]string(nil), dm.TargetLocations(target)...)
+		sort.Strings(patterns)
+		for _, pattern := range patterns {
+			refs = append(refs, &LocationRef{
+				Domain:   dm.Domain,
+				Location: pattern,
+				Kind:     patternKind(pattern),
+				Targets:  dm.locationValues(pattern),
+			})
+		}
+	}
+	return refs
+}
@@ -0,0 +1,106 @@
+package dlrouter
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestRoutesForTarget(t *testing.T) {
+	router := getQueryRouter(t)
+	expected := "[api.byted.org /admin/ api.byted.org = /admin hotsoon.byted.org /admin/ hotsoon.byted.org = /admin _ /admin/]"
+	if got := fmt.Sprint(refsOf(router.RoutesForTarget("admin"))); got != expected {
+		t.Errorf("routes of admin expected: %s; got: %s", expected, got)
+	}
+	refs := router.RoutesForTarget("api")
+	if got := fmt.Sprint(refsOf(refs)); got != "[api.byted.org / api.byted.org ~ ^/admin/v[0-9]+ api.hotsoon.com / api.hotsoon.com ~ ^/admin/v[0-9]+]" {
+		t.Errorf("routes of api unexpected: %s", got)
+	}
+	if refs[1].Kind != MatchRegex || fmt.Sprint(refs[1].Targets) != "[api]" {
+		t.Errorf("regex route of api expected; got: %+v", refs[1])
+	}
+	if refs := router.RoutesForTarget("missing"); len(refs) != 0 {
+		t.Errorf("no route of missing expected; got: %v", refsOf(refs))
+	}
+
+	//incremental changes are indexed
+	dm := router.DomainExactSearch["api.hotsoon.com"]
+	errs := dm.AppendConf(&DomainConf{Domain: dm.Domain, Target: "admin", Locations: []string{"/admin/", "= /admin", "/admin/"}})
+	if len(errs) > 0 {
+		t.Fatalf("AppendConf errors: %v", errs)
+	}
+	if got := fmt.Sprint(dm.TargetLocations("admin")); got != "[/admin/ = /admin]" {
+		t.Errorf("locations of admin expected: [/admin/ = /admin]; got: %s", got)
+	}
+	if refs := router.RoutesForTarget("admin"); len(refs) != 7 || refs[2].Domain != "api.hotsoon.com" {
+		t.Errorf("routes of admin expected to include api.hotsoon.com; got: %v", refsOf(refs))
+	}
+
+	//the index is rebuilt from snapshots
+	data, err := router.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := new(DomainLocationRouter)
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []string{"admin", "api"} {
+		expected, got := fmt.Sprint(refsOf(router.RoutesForTarget(target))), fmt.Sprint(refsOf(loaded.RoutesForTarget(target)))
+		if got != expected {
+			t.Errorf("routes of %s after snapshot expected: %s; got: %s", target, expected, got)
+		}
+	}
+}
+
+func TestRoutesForTargetNotComparable(t *testing.T) {
+	router, errs := NewRouter([]*LocationConf{
+		{Target: []string{"backend", "v1"}, MappingConf: []*MappingBlock{
+			{Domains: []string{"byted.org"}, Locations: []string{"/v1/", "~ ^/v1$"}},
+		}},
+		{Target: []string{"backend", "v2"}, MappingConf: []*MappingBlock{
+			{Domains: []string{"byted.org"}, Locations: []string{"/v2/"}},
+		}},
+	})
+	if len(errs) > 0 {
+		t.Fatalf("NewRouter errors: %v", errs)
+	}
+	if got := fmt.Sprint(refsOf(router.RoutesForTarget([]string{"backend", "v1"}))); got != "[byted.org /v1/ byted.org ~ ^/v1$]" {
+		t.Errorf("routes of v1 expected: [byted.org /v1/ byted.org ~ ^/v1$]; got: %s", got)
+	}
+}
+
+type interfaceTarget struct {
+	Backend interface{}
+}
+
+func TestRoutesForTargetInterfaceField(t *testing.T) {
+	slice, number := interfaceTarget{[]string{"a", "b"}}, interfaceTarget{1}
+	router, errs := NewRouter([]*LocationConf{
+		{Target: slice, MappingConf: []*MappingBlock{{Domains: []string{"byted.org"}, Locations: []string{"/s/", "= /s"}}}},
+		{Target: number, MappingConf: []*MappingBlock{{Domains: []string{"byted.org"}, Locations: []string{"/n/", "= /s"}}}},
+	})
+	if len(errs) > 0 {
+		t.Fatalf("NewRouter errors: %v", errs)
+	}
+	if got := fmt.Sprint(refsOf(router.RoutesForTarget(interfaceTarget{[]string{"a", "b"}}))); got != "[byted.org /s/ byted.org = /s]" {
+		t.Errorf("routes of the slice target expected: [byted.org /s/ byted.org = /s]; got: %s", got)
+	}
+	if got := fmt.Sprint(refsOf(router.RoutesForTarget(number))); got != "[byted.org /n/ byted.org = /s]" {
+		t.Errorf("routes of the number target expected: [byted.org /n/ byted.org = /s]; got: %s", got)
+	}
+	if SameTarget(slice, number) || !SameTarget(slice, interfaceTarget{[]string{"a", "b"}}) {
+		t.Errorf("SameTarget expected to compare the targets by value")
+	}
+	if targets, _ := router.GetAllTargets("byted.org", "/s"); len(targets) != 2 {
+		t.Errorf("targets of /s expected: 2; got: %v", targets)
+	}
+	targets := RemoveDuplicates([]*Target{{Value: slice}, {Value: number}, {Value: interfaceTarget{[]string{"a", "b"}}}})
+	if len(targets) != 2 || targets[1].Value != number {
+		t.Errorf("targets without duplicates expected: [slice number]; got: %v", targets)
+	}
+	if confs := router.ExportConfs(); len(confs) != 2 {
+		data, _ := json.Marshal(confs)
+		t.Errorf("2 exported confs expected; got: %s", data)
+	}
+}
@@ -0,0 +1,37 @@
+package dlrouter
+
+import (
+	"context"
+)
+
+//LookupResult describes a route resolution to a LookupTracer.
+type LookupResult struct {
+	Domain string        //the domain looked up
+	Path   string        //the path looked up
+	Router *DomainRouter //the router whose location matched, nil on a miss
+	Stage  DomainStage   //the domain search stage of Router
+	Target *Target       //nil on a miss
+}
+
+//LookupTracer traces the lookups of GetTargetContext and Middleware, e.g. as spans.
+type LookupTracer interface {
+	//StartLookup is called before a lookup. The returned function is called with its result.
+	StartLookup(ctx context.Context, domain, path string) func(result *LookupResult)
+}
+
+//GetTargetContext is GetTarget traced by the router's Tracer, if any, within ctx.
+func (m *DomainLocationRouter) GetTargetContext(ctx context.Context, domain string, path string) (*Target, bool) {
+	if m.Tracer == nil {
+		return m.GetTarget(domain, path)
+	}
+	end := m.Tracer.StartLookup(ctx, domain, path)
+	dm, stage, target, found := m.lookup(domain, path)
+	end(&LookupResult{
+		Domain: domain,
+		Path:   path,
+		Router: dm,
+		Stage:  stage,
+		Target: target,
+	})
+	return target, found
+}
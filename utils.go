@@ -1,5 +1,10 @@
 package dlrouter
 
+import (
+	"reflect"
+	"strings"
+)
+
 func GetReversedBytes(str []byte) []byte {
 	bytes := []byte(str)
 	for st, end := 0, len(bytes)-1; st < end; st, end = st+1, end-1 {
@@ -8,10 +13,31 @@ func GetReversedBytes(str []byte) []byte {
 	return bytes
 }
 
+//GetReversedLabels returns the labels of domain in reverse order, each followed by a dot, as the domain
+//is keyed in DomainPostfixSearch: "api.example.com" -> "com.example.api.". A leading dot is dropped.
+func GetReversedLabels(domain string) string {
+	return string(appendReversedLabels(make([]byte, 0, len(domain)+1), domain))
+}
+
+//appendReversedLabels appends the reversed labels of domain, see GetReversedLabels, to buf.
+func appendReversedLabels(buf []byte, domain string) []byte {
+	domain = strings.TrimPrefix(domain, ".")
+	end := len(domain)
+	for i := len(domain) - 1; i >= -1; i-- {
+		if i < 0 || domain[i] == '.' {
+			buf = append(buf, domain[i+1:end]...)
+			buf = append(buf, '.')
+			end = i
+		}
+	}
+	return buf
+}
+
+//RemoveDuplicates removes the targets whose value is the same as the one of a previous target, see SameTarget.
 func RemoveDuplicates(slice []*Target) []*Target {
 	for i := 0; i < len(slice); i++ {
 		for j := i + 1; j < len(slice); j++ {
-			if slice[i].Value == slice[j].Value {
+			if SameTarget(slice[i].Value, slice[j].Value) {
 				slice = append(slice[:j], slice[j+1:]...)
 				j--
 			}
@@ -19,3 +45,56 @@ func RemoveDuplicates(slice []*Target) []*Target {
 	}
 	return slice
 }
+
+
+//SameTarget compares targets with ==, or with reflect.DeepEqual if they are not comparable.
+func SameTarget(a, b interface{}) bool {
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return false
+	}
+	if comparableTarget(a) && comparableTarget(b) {
+		return a == b
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+//comparableTarget tells whether target can be compared with == and used as a map key without panicking.
+//The comparability of its type is not enough: a struct with an interface field holding a slice is not comparable.
+func comparableTarget(target interface{}) bool {
+	return target == nil || reflect.ValueOf(target).Comparable()
+}
+
+//targetSet numbers distinct targets in the order they are first seen.
+//Targets which are not comparable are found with reflect.DeepEqual.
+type targetSet struct {
+	values []interface{}
+	index  map[interface{}]int
+}
+
+func newTargetSet() *targetSet {
+	return &targetSet{
+		values: make([]interface{}, 0, 8),
+		index:  make(map[interface{}]int, 8),
+	}
+}
+
+func (ts *targetSet) id(target interface{}) int {
+	comparable := comparableTarget(target)
+	if comparable {
+		if id, present := ts.index[target]; present {
+			return id
+		}
+	} else {
+		for id, value := range ts.values {
+			if SameTarget(value, target) {
+				return id
+			}
+		}
+	}
+	id := len(ts.values)
+	ts.values = append(ts.values, target)
+	if comparable {
+		ts.index[target] = id
+	}
+	return id
+}